@@ -12,6 +12,7 @@ require (
 	golang.org/x/crypto v0.14.0
 	gorm.io/driver/mysql v1.6.0
 	gorm.io/gorm v1.30.0
+	rsc.io/qr v0.2.0
 )
 
 require (
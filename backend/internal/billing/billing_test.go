@@ -0,0 +1,730 @@
+package billing
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"bi-a-management/internal/models"
+)
+
+// Monday afternoon, outside any test rule window
+var base = time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return base.Add(time.Duration(minutes) * time.Minute)
+}
+
+func session(sessionType string, preset int, prepaid float64) models.TableSession {
+	return models.TableSession{
+		ID:                    1,
+		TableID:               1,
+		TableName:             "Bàn 1",
+		StartTime:             base,
+		PresetDurationMinutes: preset,
+		HourlyRate:            60000,
+		PrepaidAmount:         prepaid,
+		SessionType:           sessionType,
+	}
+}
+
+// A session started at start instead of base
+func startingAt(s models.TableSession, start time.Time) models.TableSession {
+	s.StartTime = start
+	return s
+}
+
+// The open segment of a session that never changed tables
+func singleTable(s models.TableSession) []models.SessionSegment {
+	return []models.SessionSegment{{
+		SessionID:  s.ID,
+		TableID:    s.TableID,
+		TableName:  s.TableName,
+		HourlyRate: s.HourlyRate,
+		StartedAt:  s.StartTime,
+	}}
+}
+
+func pause(from, to int) models.SessionPause {
+	resumed := at(to)
+	return models.SessionPause{PausedAt: at(from), ResumedAt: &resumed}
+}
+
+func order(name string, quantity int, unitPrice float64, status string) models.SessionOrder {
+	return models.SessionOrder{
+		ProductName: name,
+		Quantity:    quantity,
+		UnitPrice:   unitPrice,
+		TotalPrice:  float64(quantity) * unitPrice,
+		Status:      status,
+	}
+}
+
+func countLines(lines []models.InvoiceItem, itemType string) int {
+	n := 0
+	for _, line := range lines {
+		if line.ItemType == itemType {
+			n++
+		}
+	}
+	return n
+}
+
+func sumLines(lines []models.InvoiceItem) float64 {
+	var total float64
+	for _, line := range lines {
+		total += line.Amount
+	}
+	return total
+}
+
+func TestCalculate(t *testing.T) {
+	eveningRule := models.PricingRule{
+		ID:         1,
+		Name:       "Giờ cao điểm",
+		StartTime:  "15:00",
+		EndTime:    "22:00",
+		HourlyRate: 120000,
+		IsActive:   true,
+	}
+	weekendRule := models.PricingRule{
+		ID:         2,
+		Name:       "Cuối tuần",
+		Weekdays:   []int{6, 0},
+		StartTime:  "00:00",
+		EndTime:    "00:00",
+		HourlyRate: 120000,
+		IsActive:   true,
+	}
+	morningRule := models.PricingRule{
+		ID:         3,
+		Name:       "Buổi sáng",
+		StartTime:  "08:00",
+		EndTime:    "10:00",
+		HourlyRate: 120000,
+		IsActive:   true,
+	}
+	friday := time.Date(2026, 3, 6, 22, 0, 0, 0, time.UTC)
+	lateMonday := time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		session       models.TableSession
+		end           time.Time
+		pauses        []models.SessionPause
+		orders        []models.SessionOrder
+		rules         []models.PricingRule
+		manual        *models.SessionDiscount
+		policy        Policy
+		minutes       int
+		tableAmount   float64
+		ordersAmount  float64
+		total         float64
+		balanceDue    float64
+		changeDue     float64
+		tableLines    int
+		overtimeLines int
+		roundingLines int
+	}{
+		{
+			name:        "open_play bills the time played",
+			session:     session("open_play", 0, 0),
+			end:         at(90),
+			minutes:     90,
+			tableAmount: 90000,
+			total:       90000,
+			balanceDue:  90000,
+			tableLines:  1,
+		},
+		{
+			name:         "open_play with orders skips cancelled ones",
+			session:      session("open_play", 0, 0),
+			end:          at(60),
+			orders:       []models.SessionOrder{order("Coca", 2, 15000, "served"), order("Bia", 1, 25000, "cancelled")},
+			minutes:      60,
+			tableAmount:  60000,
+			ordersAmount: 30000,
+			total:        90000,
+			balanceDue:   90000,
+			tableLines:   1,
+		},
+		{
+			name:        "open_play excludes pauses",
+			session:     session("open_play", 0, 0),
+			end:         at(60),
+			pauses:      []models.SessionPause{pause(20, 35)},
+			minutes:     45,
+			tableAmount: 45000,
+			total:       45000,
+			balanceDue:  45000,
+			tableLines:  1,
+		},
+		{
+			name:        "fixed_time ended early bills the preset",
+			session:     session("fixed_time", 60, 0),
+			end:         at(30),
+			minutes:     60,
+			tableAmount: 60000,
+			total:       60000,
+			balanceDue:  60000,
+			tableLines:  1,
+		},
+		{
+			name:          "fixed_time overtime at the table rate",
+			session:       session("fixed_time", 60, 0),
+			end:           at(95),
+			minutes:       95,
+			tableAmount:   95000,
+			total:         95000,
+			balanceDue:    95000,
+			tableLines:    1,
+			overtimeLines: 1,
+		},
+		{
+			name:        "fixed_time overtime within the grace period",
+			session:     session("fixed_time", 60, 0),
+			end:         at(65),
+			policy:      Policy{GraceMinutes: 5},
+			minutes:     60,
+			tableAmount: 60000,
+			total:       60000,
+			balanceDue:  60000,
+			tableLines:  1,
+		},
+		{
+			name:          "fixed_time overtime past the grace period at the overtime rate",
+			session:       session("fixed_time", 60, 0),
+			end:           at(80),
+			policy:        Policy{GraceMinutes: 5, OvertimeRate: 90000},
+			minutes:       80,
+			tableAmount:   60000 + 30000,
+			total:         90000,
+			balanceDue:    90000,
+			tableLines:    1,
+			overtimeLines: 1,
+		},
+		{
+			name:          "fixed_time overtime skips pauses",
+			session:       session("fixed_time", 60, 0),
+			end:           at(90),
+			pauses:        []models.SessionPause{pause(10, 25)},
+			minutes:       75,
+			tableAmount:   75000,
+			total:         75000,
+			balanceDue:    75000,
+			tableLines:    1,
+			overtimeLines: 1,
+		},
+		{
+			name:         "prepaid leaves the orders to pay",
+			session:      session("fixed_time", 60, 60000),
+			end:          at(60),
+			orders:       []models.SessionOrder{order("Coca", 1, 20000, "served")},
+			minutes:      60,
+			tableAmount:  60000,
+			ordersAmount: 20000,
+			total:        80000,
+			balanceDue:   20000,
+			tableLines:   1,
+		},
+		{
+			name:        "prepaid above the total owes change",
+			session:     session("open_play", 0, 100000),
+			end:         at(30),
+			minutes:     30,
+			tableAmount: 30000,
+			total:       30000,
+			changeDue:   70000,
+			tableLines:  1,
+		},
+		{
+			name:        "discount is taken off the total",
+			session:     session("open_play", 0, 0),
+			end:         at(60),
+			manual:      &models.SessionDiscount{Amount: 10000, Reason: "Khách quen"},
+			minutes:     60,
+			tableAmount: 60000,
+			total:       50000,
+			balanceDue:  50000,
+			tableLines:  1,
+		},
+		{
+			name:        "pricing rule slices the time at its start",
+			session:     session("open_play", 0, 0),
+			end:         at(120),
+			rules:       []models.PricingRule{eveningRule},
+			minutes:     120,
+			tableAmount: 60000 + 120000,
+			total:       180000,
+			balanceDue:  180000,
+			tableLines:  2,
+		},
+		{
+			name:        "weekday rule opens after midnight",
+			session:     startingAt(session("open_play", 0, 0), friday),
+			end:         friday.Add(4 * time.Hour),
+			rules:       []models.PricingRule{weekendRule},
+			minutes:     240,
+			tableAmount: 2*60000 + 2*120000,
+			total:       360000,
+			balanceDue:  360000,
+			tableLines:  2,
+		},
+		{
+			name:        "rule window on the day after the start",
+			session:     startingAt(session("open_play", 0, 0), lateMonday),
+			end:         lateMonday.Add(11 * time.Hour),
+			rules:       []models.PricingRule{morningRule},
+			minutes:     660,
+			tableAmount: 9*60000 + 2*120000,
+			total:       780000,
+			balanceDue:  780000,
+			tableLines:  2,
+		},
+		{
+			name:        "minimum duration",
+			session:     session("open_play", 0, 0),
+			end:         at(7),
+			policy:      Policy{MinimumMinutes: 30, RoundMinutes: 15},
+			minutes:     30,
+			tableAmount: 30000,
+			total:       30000,
+			balanceDue:  30000,
+			tableLines:  1,
+		},
+		{
+			name:        "time rounded up to a block",
+			session:     session("open_play", 0, 0),
+			end:         at(37),
+			policy:      Policy{MinimumMinutes: 30, RoundMinutes: 15},
+			minutes:     45,
+			tableAmount: 45000,
+			total:       45000,
+			balanceDue:  45000,
+			tableLines:  1,
+		},
+		{
+			name:          "total rounded with a rounding line",
+			session:       session("open_play", 0, 0),
+			end:           at(13),
+			policy:        Policy{RoundAmount: 1000},
+			orders:        []models.SessionOrder{order("Trà đá", 1, 2500, "served")},
+			minutes:       13,
+			tableAmount:   13000,
+			ordersAmount:  2500,
+			total:         16000,
+			balanceDue:    16000,
+			tableLines:    1,
+			roundingLines: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote := Calculate(Input{
+				Session:  tt.session,
+				Segments: singleTable(tt.session),
+				Pauses:   tt.pauses,
+				Orders:   tt.orders,
+				Rules:    tt.rules,
+				End:      tt.end,
+
+				ManualDiscount: tt.manual,
+			}, tt.policy)
+
+			if quote.Minutes != tt.minutes {
+				t.Errorf("minutes = %d, want %d", quote.Minutes, tt.minutes)
+			}
+			if quote.TableAmount != tt.tableAmount {
+				t.Errorf("table amount = %v, want %v", quote.TableAmount, tt.tableAmount)
+			}
+			if quote.OrdersAmount != tt.ordersAmount {
+				t.Errorf("orders amount = %v, want %v", quote.OrdersAmount, tt.ordersAmount)
+			}
+			if quote.Total != tt.total {
+				t.Errorf("total = %v, want %v", quote.Total, tt.total)
+			}
+			if quote.BalanceDue != tt.balanceDue {
+				t.Errorf("balance due = %v, want %v", quote.BalanceDue, tt.balanceDue)
+			}
+			if quote.ChangeDue != tt.changeDue {
+				t.Errorf("change due = %v, want %v", quote.ChangeDue, tt.changeDue)
+			}
+			if n := countLines(quote.Lines, "table_time"); n != tt.tableLines {
+				t.Errorf("table_time lines = %d, want %d", n, tt.tableLines)
+			}
+			if n := countLines(quote.Lines, "overtime"); n != tt.overtimeLines {
+				t.Errorf("overtime lines = %d, want %d", n, tt.overtimeLines)
+			}
+			if n := countLines(quote.Lines, "rounding"); n != tt.roundingLines {
+				t.Errorf("rounding lines = %d, want %d", n, tt.roundingLines)
+			}
+			if sum := sumLines(quote.Lines); math.Abs(sum-quote.Total) > 0.001 {
+				t.Errorf("lines add up to %v, total is %v", sum, quote.Total)
+			}
+		})
+	}
+}
+
+func TestDiscounts(t *testing.T) {
+	drink := order("Bia", 2, 25000, "served")
+	drink.ID, drink.Category = 1, "drink"
+	snack := order("Đậu phộng", 1, 20000, "served")
+	snack.ID, snack.Category = 2, "food"
+	orders := []models.SessionOrder{drink, snack}
+
+	until := at(-10)
+	snackID, goneID := uint(2), uint(9)
+	tests := []struct {
+		name        string
+		redemptions []models.PointRedemption
+		tier        *models.MemberTier
+		promotions  []models.Promotion
+		manual      *models.SessionDiscount
+		discount    float64
+		discounts   int
+	}{
+		{
+			name:       "percentage off table time",
+			promotions: []models.Promotion{{ID: 1, Name: "Giờ vàng", Kind: "percentage", Value: 20, Target: "table_time", IsActive: true}},
+			discount:   12000,
+			discounts:  1,
+		},
+		{
+			name:       "percentage capped",
+			promotions: []models.Promotion{{ID: 1, Name: "Giờ vàng", Kind: "percentage", Value: 20, MaxDiscount: 5000, Target: "table_time", IsActive: true}},
+			discount:   5000,
+			discounts:  1,
+		},
+		{
+			name:       "fixed amount on a category is limited to that category",
+			promotions: []models.Promotion{{ID: 2, Name: "Bia", Code: "BIA", Kind: "fixed", Value: 80000, Target: "category", Category: "drink", IsActive: true}},
+			discount:   50000,
+			discounts:  1,
+		},
+		{
+			name: "category then orders share what the orders have left",
+			promotions: []models.Promotion{
+				{ID: 2, Name: "Bia", Kind: "fixed", Value: 50000, Target: "category", Category: "drink", IsActive: true},
+				{ID: 3, Name: "Đồ ăn", Kind: "percentage", Value: 50, Target: "orders", IsActive: true},
+			},
+			discount:  60000,
+			discounts: 2,
+		},
+		{
+			name: "expired, inactive and used up promotions are skipped",
+			promotions: []models.Promotion{
+				{ID: 4, Name: "Hết hạn", Kind: "fixed", Value: 1000, Target: "table_time", EndsAt: &until, IsActive: true},
+				{ID: 5, Name: "Tắt", Kind: "fixed", Value: 1000, Target: "table_time"},
+				{ID: 6, Name: "Hết lượt", Kind: "fixed", Value: 1000, Target: "table_time", UsageLimit: 3, UsageCount: 3, IsActive: true},
+			},
+		},
+		{
+			name:       "manual percentage on what promotions left",
+			promotions: []models.Promotion{{ID: 1, Name: "Giờ vàng", Kind: "fixed", Value: 10000, Target: "table_time", IsActive: true}},
+			manual:     &models.SessionDiscount{Percent: 10, Reason: "Khách quen", ApprovedBy: 1},
+			discount:   10000 + 12000,
+			discounts:  2,
+		},
+		{
+			name:      "member tier takes a percentage off table time",
+			tier:      &models.MemberTier{Code: "gold", Name: "Vàng", RateDiscountPercent: 10},
+			discount:  6000,
+			discounts: 1,
+		},
+		{
+			name:       "promotions apply to what the member discount left",
+			tier:       &models.MemberTier{Code: "gold", Name: "Vàng", RateDiscountPercent: 10},
+			promotions: []models.Promotion{{ID: 1, Name: "Giờ vàng", Kind: "percentage", Value: 20, Target: "table_time", IsActive: true}},
+			discount:   6000 + 10800,
+			discounts:  2,
+		},
+		{
+			name:        "free minutes for points",
+			redemptions: []models.PointRedemption{{Minutes: 10, Description: "10 phút miễn phí", Points: 20, Value: 10000}},
+			discount:    10000,
+			discounts:   1,
+		},
+		{
+			name:        "member discount applies to the table time points left",
+			redemptions: []models.PointRedemption{{Minutes: 10, Description: "10 phút miễn phí", Points: 20, Value: 10000}},
+			tier:        &models.MemberTier{Code: "gold", Name: "Vàng", RateDiscountPercent: 10},
+			discount:    10000 + 5000,
+			discounts:   2,
+		},
+		{
+			name:        "free minutes never exceed table time",
+			redemptions: []models.PointRedemption{{Minutes: 120, Description: "120 phút miễn phí", Points: 240, Value: 120000}},
+			discount:    60000,
+			discounts:   1,
+		},
+		{
+			name: "order paid with points, cancelled order skipped",
+			redemptions: []models.PointRedemption{
+				{OrderID: &snackID, Description: "Đậu phộng x1", Points: 40, Value: 20000},
+				{OrderID: &goneID, Description: "Nước suối x1", Points: 20, Value: 10000},
+			},
+			discount:  20000,
+			discounts: 1,
+		},
+		{
+			name:      "manual amount never exceeds the bill",
+			manual:    &models.SessionDiscount{Amount: 500000, Reason: "Sự cố bàn", ApprovedBy: 1},
+			discount:  130000,
+			discounts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := session("open_play", 0, 0)
+			quote := Calculate(Input{
+				Session:  s,
+				Segments: singleTable(s),
+				Orders:   orders,
+				End:      at(60),
+
+				Redemptions:    tt.redemptions,
+				MemberTier:     tt.tier,
+				Promotions:     tt.promotions,
+				ManualDiscount: tt.manual,
+			}, Policy{})
+
+			if quote.Discount != tt.discount {
+				t.Errorf("discount = %v, want %v", quote.Discount, tt.discount)
+			}
+			if len(quote.Discounts) != tt.discounts {
+				t.Errorf("discounts = %d, want %d", len(quote.Discounts), tt.discounts)
+			}
+			if want := 60000 + 70000 - tt.discount; quote.Total != want {
+				t.Errorf("total = %v, want %v", quote.Total, want)
+			}
+			if sum := sumLines(quote.Lines); math.Abs(sum-quote.Total) > 0.001 {
+				t.Errorf("lines add up to %v, total is %v", sum, quote.Total)
+			}
+		})
+	}
+}
+
+func TestCalculateTransferredSession(t *testing.T) {
+	s := session("open_play", 0, 0)
+	s.TableID, s.TableName, s.HourlyRate = 2, "Bàn VIP", 120000
+
+	movedAt := at(30)
+	segments := []models.SessionSegment{
+		{SessionID: 1, TableID: 1, TableName: "Bàn 1", HourlyRate: 60000, StartedAt: base, EndedAt: &movedAt},
+		{SessionID: 1, TableID: 2, TableName: "Bàn VIP", HourlyRate: 120000, StartedAt: movedAt},
+	}
+
+	quote := Calculate(Input{Session: s, Segments: segments, End: at(60)}, Policy{})
+
+	if quote.Minutes != 60 {
+		t.Errorf("minutes = %d, want 60", quote.Minutes)
+	}
+	if quote.TableAmount != 30000+60000 {
+		t.Errorf("table amount = %v, want 90000", quote.TableAmount)
+	}
+	if len(quote.TableNames) != 2 {
+		t.Errorf("table names = %v, want both tables", quote.TableNames)
+	}
+}
+
+func TestOrderNote(t *testing.T) {
+	s := session("open_play", 0, 0)
+	withNote := order("Trà đá", 1, 2500, "served")
+	withNote.Note = "ít đá"
+
+	quote := Calculate(Input{
+		Session:  s,
+		Segments: singleTable(s),
+		Orders:   []models.SessionOrder{withNote, order("Nước suối", 1, 10000, "served")},
+		End:      at(60),
+	}, Policy{})
+
+	var lines []models.InvoiceItem
+	for _, line := range quote.Lines {
+		if line.ItemType == "order" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 2 || lines[0].Description != "Trà đá" || lines[0].Note != "ít đá" || lines[1].Note != "" {
+		t.Errorf("order lines = %+v, want the note on the first product only", lines)
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	valid := map[string]int{"00:00": 0, "08:30": 510, "18:00:00": 1080, "23:59:59": 1439}
+	for value, want := range valid {
+		if got, err := ParseClock(value); err != nil || got != want {
+			t.Errorf("ParseClock(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "18", "24:00", "18:60", "18:00:xx", "18:00:60", "18:00:00:00"} {
+		if _, err := ParseClock(value); err == nil {
+			t.Errorf("ParseClock(%q) should fail", value)
+		}
+	}
+}
+
+func TestRulesForTable(t *testing.T) {
+	allTables := models.PricingRule{ID: 1, Priority: 0}
+	snooker := models.PricingRule{ID: 2, TableType: "snooker", Priority: 0}
+	vipRoom := models.PricingRule{ID: 3, Zone: "vip", Priority: 0}
+	table7 := models.PricingRule{ID: 4, TableIDs: []uint{7}, Priority: 0}
+	happyHour := models.PricingRule{ID: 5, Priority: 10}
+	rules := []models.PricingRule{allTables, snooker, vipRoom, table7, happyHour}
+
+	tests := []struct {
+		name    string
+		segment models.SessionSegment
+		want    []uint
+	}{
+		{
+			name:    "pool table on the floor gets the general rules",
+			segment: models.SessionSegment{TableID: 1, TableType: "pool", Zone: "floor"},
+			want:    []uint{5, 1},
+		},
+		{
+			name:    "snooker table gets its type rule before the general one",
+			segment: models.SessionSegment{TableID: 2, TableType: "snooker", Zone: "floor"},
+			want:    []uint{5, 2, 1},
+		},
+		{
+			name:    "table rule wins over type and zone rules at the same priority",
+			segment: models.SessionSegment{TableID: 7, TableType: "snooker", Zone: "vip"},
+			want:    []uint{5, 4, 2, 3, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched := rulesForTable(rules, tt.segment)
+
+			var got []uint
+			for _, rule := range matched {
+				got = append(got, rule.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("rules = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("rules = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCombine(t *testing.T) {
+	policy := Policy{RoundAmount: 1000}
+
+	first := session("open_play", 0, 10000)
+	second := session("open_play", 0, 0)
+	second.ID = 2
+
+	quotes := []*Quote{
+		Calculate(Input{Session: first, Segments: singleTable(first), End: at(10), // 10000
+			Orders: []models.SessionOrder{order("Trà đá", 1, 2400, "served")}}, policy),
+		Calculate(Input{Session: second, Segments: singleTable(second), End: at(20), // 20000
+			Orders: []models.SessionOrder{order("Trà đá", 1, 2400, "served")}}, policy),
+	}
+
+	combined := Combine(quotes, policy)
+
+	if len(combined.SessionIDs) != 2 {
+		t.Errorf("session ids = %v, want 2", combined.SessionIDs)
+	}
+	if combined.Minutes != 30 {
+		t.Errorf("minutes = %d, want 30", combined.Minutes)
+	}
+	// 34800 rounds once to 35000; rounding each part first would give 34000
+	if combined.Total != 35000 {
+		t.Errorf("total = %v, want 35000", combined.Total)
+	}
+	if combined.BalanceDue != 25000 {
+		t.Errorf("balance due = %v, want 25000", combined.BalanceDue)
+	}
+	if n := countLines(combined.Lines, "rounding"); n != 1 {
+		t.Errorf("rounding lines = %d, want 1", n)
+	}
+	if sum := sumLines(combined.Lines); math.Abs(sum-combined.Total) > 0.001 {
+		t.Errorf("lines add up to %v, total is %v", sum, combined.Total)
+	}
+}
+
+// A session that ended before the merge is billed to its own end, not to the
+// time of the merge, and picks up no overtime meanwhile
+func TestCombineEndedSession(t *testing.T) {
+	ended := session("fixed_time", 60, 0)
+	endedAt := at(60)
+	ended.Status = "completed"
+	ended.EndTime = &endedAt
+
+	running := session("open_play", 0, 0)
+	running.ID = 2
+
+	mergedAt := at(120)
+	first := Calculate(Input{Session: ended, Segments: singleTable(ended), End: mergedAt}, Policy{})
+	second := Calculate(Input{Session: running, Segments: singleTable(running), End: mergedAt}, Policy{})
+
+	if first.Total != 60000 {
+		t.Errorf("ended session total = %v, want 60000", first.Total)
+	}
+	if first.OvertimeMinutes != 0 || countLines(first.Lines, "overtime") != 0 {
+		t.Errorf("ended session billed %d overtime minutes, want none", first.OvertimeMinutes)
+	}
+	if !first.EndTime.Equal(endedAt) {
+		t.Errorf("ended session end = %v, want %v", first.EndTime, endedAt)
+	}
+
+	combined := Combine([]*Quote{first, second}, Policy{})
+	if combined.Total != 180000 {
+		t.Errorf("combined total = %v, want 180000", combined.Total)
+	}
+	if !combined.EndTime.Equal(mergedAt) {
+		t.Errorf("combined end = %v, want %v", combined.EndTime, mergedAt)
+	}
+}
+
+func TestPolicyBilledMinutes(t *testing.T) {
+	tests := []struct {
+		policy  Policy
+		minutes int
+		want    int
+	}{
+		{Policy{}, 0, 0},
+		{Policy{}, 37, 37},
+		{Policy{RoundMinutes: 15}, 30, 30},
+		{Policy{RoundMinutes: 15}, 31, 45},
+		{Policy{MinimumMinutes: 60}, 20, 60},
+		{Policy{MinimumMinutes: 60, RoundMinutes: 15}, 61, 75},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.BilledMinutes(tt.minutes); got != tt.want {
+			t.Errorf("%+v.BilledMinutes(%d) = %d, want %d", tt.policy, tt.minutes, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyOvertimeMinutes(t *testing.T) {
+	tests := []struct {
+		policy  Policy
+		minutes int
+		want    int
+	}{
+		{Policy{}, -10, 0},
+		{Policy{}, 7, 7},
+		{Policy{GraceMinutes: 10}, 10, 0},
+		{Policy{GraceMinutes: 10}, 11, 11},
+		{Policy{GraceMinutes: 5, RoundMinutes: 15}, 7, 15},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.OvertimeMinutes(tt.minutes); got != tt.want {
+			t.Errorf("%+v.OvertimeMinutes(%d) = %d, want %d", tt.policy, tt.minutes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package billing
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"bi-a-management/internal/models"
+)
+
+// AppliedDiscount is a points, member, promotion or manual discount taken off
+// a quote
+type AppliedDiscount struct {
+	Kind        string  `json:"kind"`                   // points, member, promotion, manual
+	PromotionID uint    `json:"promotion_id,omitempty"` // 0 unless Kind is promotion
+	Code        string  `json:"code,omitempty"`
+	Name        string  `json:"name"`
+	Reason      string  `json:"reason,omitempty"`
+	ApprovedBy  uint    `json:"approved_by,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+// PromotionApplies reports whether a promotion can be used at a time: it is
+// active, inside its window and under its usage limit
+func PromotionApplies(promotion models.Promotion, at time.Time) bool {
+	if !promotion.IsActive {
+		return false
+	}
+	if promotion.StartsAt != nil && at.Before(*promotion.StartsAt) {
+		return false
+	}
+	if promotion.EndsAt != nil && !at.Before(*promotion.EndsAt) {
+		return false
+	}
+	return promotion.UsageLimit == 0 || promotion.UsageCount < promotion.UsageLimit
+}
+
+// What is left to discount on each target. A category is part of the
+// orders, so a category discount uses up both.
+type discountBase struct {
+	table      float64
+	orders     float64
+	categories map[string]float64
+}
+
+// Take points redemptions, then the member discount, then promotions, then
+// the manual discount off the quote. Each discount is worked out on what its
+// target has left after the ones before it, so the bill never goes below zero.
+func (q *Quote) applyDiscounts(orders []models.SessionOrder, redemptions []models.PointRedemption, tier *models.MemberTier, promotions []models.Promotion, manual *models.SessionDiscount, at time.Time) {
+	base := discountBase{table: q.TableAmount, orders: q.OrdersAmount, categories: map[string]float64{}}
+	live := make(map[uint]models.SessionOrder)
+	for _, order := range orders {
+		if order.Status != "cancelled" {
+			base.categories[order.Category] += order.TotalPrice
+			live[order.ID] = order
+		}
+	}
+
+	// Points pay for free minutes and whole orders before anything else is
+	// worked out. An order cancelled after it was paid with points is skipped.
+	for _, redemption := range redemptions {
+		var amount float64
+		if redemption.OrderID == nil {
+			amount = math.Min(redemption.Value, base.table)
+			base.table -= amount
+		} else if order, ok := live[*redemption.OrderID]; ok {
+			amount = math.Min(redemption.Value, math.Min(base.categories[order.Category], base.orders))
+			base.orders -= amount
+			base.categories[order.Category] -= amount
+		}
+		if amount <= 0 {
+			continue
+		}
+
+		q.addDiscount("points_redemption", fmt.Sprintf("Đổi điểm: %s (%d điểm)", redemption.Description, redemption.Points), AppliedDiscount{
+			Kind:   "points",
+			Name:   redemption.Description,
+			Amount: amount,
+		})
+	}
+
+	// Members pay a lower hourly rate, which comes to the same percentage off
+	// all their table time
+	if tier != nil && tier.RateDiscountPercent > 0 {
+		amount := math.Min(math.Round(base.table*tier.RateDiscountPercent/100), base.table)
+		if amount > 0 {
+			base.table -= amount
+			q.addDiscount("member_discount", fmt.Sprintf("Giảm giá thành viên %s (%g%%)", tier.Name, tier.RateDiscountPercent), AppliedDiscount{
+				Kind:   "member",
+				Code:   tier.Code,
+				Name:   tier.Name,
+				Amount: amount,
+			})
+		}
+	}
+
+	for _, promotion := range promotions {
+		if !PromotionApplies(promotion, at) {
+			continue
+		}
+
+		available := base.table
+		switch promotion.Target {
+		case "orders":
+			available = base.orders
+		case "category":
+			available = math.Min(base.categories[promotion.Category], base.orders)
+		}
+
+		amount := promotion.Value
+		if promotion.Kind == "percentage" {
+			amount = math.Round(available * promotion.Value / 100)
+			if promotion.MaxDiscount > 0 {
+				amount = math.Min(amount, promotion.MaxDiscount)
+			}
+		}
+		amount = math.Min(amount, available)
+		if amount <= 0 {
+			continue
+		}
+
+		switch promotion.Target {
+		case "table_time":
+			base.table -= amount
+		case "orders":
+			base.orders -= amount
+		case "category":
+			base.orders -= amount
+			base.categories[promotion.Category] -= amount
+		}
+
+		description := fmt.Sprintf("Khuyến mãi: %s", promotion.Name)
+		if promotion.Code != "" {
+			description += fmt.Sprintf(" (%s)", promotion.Code)
+		}
+		q.addDiscount("promotion", description, AppliedDiscount{
+			Kind:        "promotion",
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Name:        promotion.Name,
+			Amount:      amount,
+		})
+	}
+
+	if manual != nil {
+		left := base.table + base.orders
+		amount := math.Min(manual.Amount, left)
+		if manual.Percent > 0 {
+			amount = math.Round(left * manual.Percent / 100)
+		}
+		if amount > 0 {
+			q.addDiscount("discount", fmt.Sprintf("Giảm giá: %s", manual.Reason), AppliedDiscount{
+				Kind:       "manual",
+				Name:       "Giảm giá",
+				Reason:     manual.Reason,
+				ApprovedBy: manual.ApprovedBy,
+				Amount:     amount,
+			})
+		}
+	}
+}
+
+func (q *Quote) addDiscount(itemType string, description string, discount AppliedDiscount) {
+	q.Discount += discount.Amount
+	q.Discounts = append(q.Discounts, discount)
+	q.Lines = append(q.Lines, models.InvoiceItem{
+		ItemType:    itemType,
+		Description: description,
+		Quantity:    1,
+		UnitPrice:   -discount.Amount,
+		Amount:      -discount.Amount,
+	})
+}
@@ -0,0 +1,58 @@
+package billing
+
+import (
+	"math"
+
+	"bi-a-management/internal/config"
+)
+
+// Policy controls how played time and totals are rounded. It is applied
+// the same way to the realtime preview and to the invoice.
+type Policy struct {
+	RoundMinutes   int     // bill time in blocks of this many minutes, 0 = per minute
+	MinimumMinutes int     // never bill less than this
+	RoundAmount    float64 // round totals to the nearest multiple, 0 = no rounding
+	OvertimeRate   float64 // hourly rate past a fixed_time preset, 0 = the table's rate
+	GraceMinutes   int     // overtime up to this many minutes is not charged
+}
+
+func NewPolicy(cfg *config.Config) Policy {
+	return Policy{
+		RoundMinutes:   cfg.BillingRoundMinutes,
+		MinimumMinutes: cfg.BillingMinimumMinutes,
+		RoundAmount:    float64(cfg.BillingRoundAmount),
+		OvertimeRate:   float64(cfg.OvertimeHourlyRate),
+		GraceMinutes:   cfg.OvertimeGraceMinutes,
+	}
+}
+
+// BilledMinutes applies the minimum duration and rounds up to a whole block
+func (p Policy) BilledMinutes(minutes int) int {
+	if minutes < p.MinimumMinutes {
+		minutes = p.MinimumMinutes
+	}
+	if p.RoundMinutes > 0 && minutes%p.RoundMinutes != 0 {
+		minutes += p.RoundMinutes - minutes%p.RoundMinutes
+	}
+	return minutes
+}
+
+// OvertimeMinutes is the overtime to charge: nothing within the grace period,
+// otherwise all of it rounded up to a whole block
+func (p Policy) OvertimeMinutes(minutes int) int {
+	if minutes <= 0 || minutes <= p.GraceMinutes {
+		return 0
+	}
+	if p.RoundMinutes > 0 && minutes%p.RoundMinutes != 0 {
+		minutes += p.RoundMinutes - minutes%p.RoundMinutes
+	}
+	return minutes
+}
+
+// RoundTotal rounds an amount to the nearest RoundAmount
+func (p Policy) RoundTotal(amount float64) float64 {
+	if p.RoundAmount <= 0 {
+		return amount
+	}
+	return math.Round(amount/p.RoundAmount) * p.RoundAmount
+}
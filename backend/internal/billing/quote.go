@@ -0,0 +1,294 @@
+package billing
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"bi-a-management/internal/models"
+)
+
+// Input is everything that decides what a session costs
+type Input struct {
+	Session  models.TableSession
+	Segments []models.SessionSegment // from the first table to the current one
+	Pauses   []models.SessionPause
+	Orders   []models.SessionOrder // cancelled orders are skipped
+	Rules    []models.PricingRule  // active pricing rules
+	End      time.Time             // now; a session that ended is priced to its EndTime instead
+
+	Redemptions    []models.PointRedemption // loyalty points spent on the session
+	MemberTier     *models.MemberTier       // tier of the member playing, nil for walk-ins
+	Promotions     []models.Promotion       // automatic ones and those entered by code
+	ManualDiscount *models.SessionDiscount  // granted by a manager, nil if none
+}
+
+// Quote is the itemized bill of one or more sessions. Every endpoint that shows
+// or stores money takes its numbers from a Quote.
+type Quote struct {
+	SessionIDs      []uint               `json:"session_ids"`
+	SessionType     string               `json:"session_type"`
+	CustomerName    string               `json:"customer_name"`
+	CustomerID      *uint                `json:"customer_id,omitempty"`
+	TableNames      []string             `json:"table_names"`
+	StartTime       time.Time            `json:"start_time"`
+	EndTime         time.Time            `json:"end_time"`
+	Minutes         int                  `json:"minutes"`
+	OvertimeMinutes int                  `json:"overtime_minutes"`
+	HourlyRate      float64              `json:"hourly_rate"`
+	TableAmount     float64              `json:"table_amount"` // includes overtime
+	OvertimeAmount  float64              `json:"overtime_amount"`
+	OrdersAmount    float64              `json:"orders_amount"`
+	Discount        float64              `json:"discount"` // points, member, promotion and manual discounts
+	Rounding        float64              `json:"rounding"`
+	Total           float64              `json:"total_amount"`
+	PrepaidAmount   float64              `json:"prepaid_amount"`
+	BalanceDue      float64              `json:"balance_due"` // still to collect after the deposit
+	ChangeDue       float64              `json:"change_due"`  // deposit to refund when it exceeds the total
+	Lines           []models.InvoiceItem `json:"lines"`
+	Discounts       []AppliedDiscount    `json:"discounts,omitempty"`
+}
+
+// Billed table time of one segment, split into slices at pricing rule boundaries
+type segmentCharge struct {
+	Segment models.SessionSegment
+	Minutes int
+	Amount  float64
+	Slices  []priceSlice
+}
+
+// Calculate prices a single session
+func Calculate(in Input, policy Policy) *Quote {
+	session := in.Session
+	end := in.End
+	if session.EndTime != nil {
+		// An ended session is not billed for the time since it ended
+		end = *session.EndTime
+	}
+
+	charges, minutes, tableAmount := priceTableTime(
+		session.SessionType, session.PresetDurationMinutes, in.Segments, in.Pauses, in.Rules, policy, end,
+	)
+
+	quote := &Quote{
+		SessionIDs:    []uint{session.ID},
+		SessionType:   session.SessionType,
+		CustomerName:  session.CustomerName,
+		CustomerID:    session.CustomerID,
+		StartTime:     session.StartTime,
+		EndTime:       end,
+		Minutes:       minutes,
+		HourlyRate:    session.HourlyRate,
+		TableAmount:   tableAmount,
+		PrepaidAmount: session.PrepaidAmount,
+	}
+
+	for _, charge := range charges {
+		quote.Lines = append(quote.Lines, segmentLines(charge)...)
+		quote.TableNames = append(quote.TableNames, charge.Segment.TableName)
+	}
+
+	if session.SessionType == "fixed_time" {
+		if line := overtimeLine(session, in.Segments, in.Pauses, policy, end); line != nil {
+			quote.Lines = append(quote.Lines, *line)
+			quote.OvertimeMinutes = line.Minutes
+			quote.OvertimeAmount = line.Amount
+			quote.Minutes += line.Minutes
+			quote.TableAmount += line.Amount
+		}
+	}
+
+	for _, order := range in.Orders {
+		if order.Status == "cancelled" {
+			continue
+		}
+		quote.OrdersAmount += order.TotalPrice
+		quote.Lines = append(quote.Lines, models.InvoiceItem{
+			ItemType:    "order",
+			Description: order.ProductName,
+			Note:        order.Note,
+			Quantity:    order.Quantity,
+			UnitPrice:   order.UnitPrice,
+			Amount:      order.TotalPrice,
+		})
+	}
+
+	quote.applyDiscounts(in.Orders, in.Redemptions, in.MemberTier, in.Promotions, in.ManualDiscount, end)
+
+	quote.finish(policy)
+	return quote
+}
+
+// Combine merges the quotes of several sessions into one bill. Rounding is
+// applied once, to the combined total.
+func Combine(quotes []*Quote, policy Policy) *Quote {
+	combined := &Quote{}
+	for i, quote := range quotes {
+		if i == 0 {
+			*combined = *quote
+			combined.SessionIDs = nil
+			combined.TableNames = nil
+			combined.Lines = nil
+			combined.Discounts = nil
+			combined.Minutes, combined.TableAmount, combined.OrdersAmount = 0, 0, 0
+			combined.OvertimeMinutes, combined.OvertimeAmount = 0, 0
+			combined.Discount, combined.PrepaidAmount = 0, 0
+		}
+		if quote.StartTime.Before(combined.StartTime) {
+			combined.StartTime = quote.StartTime
+		}
+		if quote.EndTime.After(combined.EndTime) {
+			combined.EndTime = quote.EndTime
+		}
+
+		combined.SessionIDs = append(combined.SessionIDs, quote.SessionIDs...)
+		combined.TableNames = append(combined.TableNames, quote.TableNames...)
+		combined.Minutes += quote.Minutes
+		combined.OvertimeMinutes += quote.OvertimeMinutes
+		combined.OvertimeAmount += quote.OvertimeAmount
+		combined.TableAmount += quote.TableAmount
+		combined.OrdersAmount += quote.OrdersAmount
+		combined.Discount += quote.Discount
+		combined.PrepaidAmount += quote.PrepaidAmount
+		combined.Discounts = append(combined.Discounts, quote.Discounts...)
+		for _, line := range quote.Lines {
+			if line.ItemType != "rounding" {
+				combined.Lines = append(combined.Lines, line)
+			}
+		}
+	}
+
+	combined.finish(policy)
+	return combined
+}
+
+// Work out rounding, total and balance from the amounts
+func (q *Quote) finish(policy Policy) {
+	subtotal := q.TableAmount + q.OrdersAmount - q.Discount
+	q.Total = policy.RoundTotal(subtotal)
+	q.Rounding = q.Total - subtotal
+
+	if q.Rounding != 0 {
+		q.Lines = append(q.Lines, models.InvoiceItem{
+			ItemType:    "rounding",
+			Description: "Làm tròn",
+			Quantity:    1,
+			UnitPrice:   q.Rounding,
+			Amount:      q.Rounding,
+		})
+	}
+
+	balance := q.Total - q.PrepaidAmount
+	q.BalanceDue = math.Max(balance, 0)
+	q.ChangeDue = math.Max(-balance, 0)
+}
+
+// Split the billed table time of a session over its segments, each at its
+// own hourly rate and further sliced wherever a pricing rule starts or ends.
+// fixed_time sessions always bill the preset duration: earlier segments bill
+// what was played on them and the current table the rest.
+func priceTableTime(sessionType string, presetMinutes int, segments []models.SessionSegment, pauses []models.SessionPause, rules []models.PricingRule, policy Policy, end time.Time) ([]segmentCharge, int, float64) {
+	var charges []segmentCharge
+	var totalMinutes int
+	var totalAmount float64
+
+	remaining := presetMinutes
+	for i, segment := range segments {
+		segmentEnd := end
+		if segment.EndedAt != nil {
+			segmentEnd = *segment.EndedAt
+		}
+		minutes := int(playedDuration(segment.StartedAt, segmentEnd, pauses).Minutes())
+
+		if sessionType == "fixed_time" {
+			if i == len(segments)-1 || minutes > remaining {
+				minutes = remaining
+			}
+			remaining -= minutes
+			// The prepaid block is priced over its planned timeline
+			segmentEnd = playedUntil(segment.StartedAt, minutes, pauses, segmentEnd)
+		}
+
+		slices := sliceByRules(segment.StartedAt, segmentEnd, pauses, segment.HourlyRate, rulesForTable(rules, segment), minutes)
+		charge := segmentCharge{Segment: segment, Minutes: minutes, Slices: slices}
+		for _, slice := range slices {
+			charge.Amount += slice.Amount
+		}
+
+		charges = append(charges, charge)
+		totalMinutes += minutes
+		totalAmount += charge.Amount
+	}
+
+	// Minimum duration and block rounding add time at the rate of the last slice
+	if extra := policy.BilledMinutes(totalMinutes) - totalMinutes; extra > 0 && len(charges) > 0 {
+		charge := &charges[len(charges)-1]
+		slice := &charge.Slices[len(charge.Slices)-1]
+		slice.Minutes += extra
+		added := (float64(extra) / 60.0) * slice.HourlyRate
+		slice.Amount += added
+		charge.Minutes += extra
+		charge.Amount += added
+		totalMinutes += extra
+		totalAmount += added
+	}
+
+	return charges, totalMinutes, totalAmount
+}
+
+// Invoice lines for a segment charge, one per priced slice
+func segmentLines(charge segmentCharge) []models.InvoiceItem {
+	var items []models.InvoiceItem
+	for _, slice := range charge.Slices {
+		start, end := slice.Start, slice.End
+		description := fmt.Sprintf("Giờ chơi %s", charge.Segment.TableName)
+		if slice.Rule != nil {
+			description += fmt.Sprintf(" (%s)", slice.Rule.Name)
+		}
+
+		items = append(items, models.InvoiceItem{
+			ItemType:    "table_time",
+			Description: description,
+			StartTime:   &start,
+			EndTime:     &end,
+			Minutes:     slice.Minutes,
+			Quantity:    1,
+			UnitPrice:   slice.HourlyRate,
+			Amount:      slice.Amount,
+		})
+	}
+	return items
+}
+
+// Played time past the preset of a fixed_time session, billed on the table
+// the session ended on. Nil when there is no chargeable overtime.
+func overtimeLine(session models.TableSession, segments []models.SessionSegment, pauses []models.SessionPause, policy Policy, end time.Time) *models.InvoiceItem {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	played := int(playedDuration(session.StartTime, end, pauses).Minutes())
+	minutes := policy.OvertimeMinutes(played - session.PresetDurationMinutes)
+	if minutes == 0 {
+		return nil
+	}
+
+	last := segments[len(segments)-1]
+	rate := policy.OvertimeRate
+	if rate <= 0 {
+		rate = last.HourlyRate
+	}
+
+	start := playedUntil(session.StartTime, session.PresetDurationMinutes, pauses, end)
+	amount := (float64(minutes) / 60.0) * rate
+	return &models.InvoiceItem{
+		ItemType:    "overtime",
+		Description: fmt.Sprintf("Quá giờ %s", last.TableName),
+		StartTime:   &start,
+		EndTime:     &end,
+		Minutes:     minutes,
+		Quantity:    1,
+		UnitPrice:   rate,
+		Amount:      amount,
+	}
+}
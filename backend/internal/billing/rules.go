@@ -0,0 +1,133 @@
+package billing
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bi-a-management/internal/models"
+)
+
+// Rules that can apply to the table of a segment, highest priority first; at
+// the same priority a rule for specific tables wins over one for a table
+// type or zone, which wins over a rule for all tables
+func rulesForTable(rules []models.PricingRule, segment models.SessionSegment) []models.PricingRule {
+	var matched []models.PricingRule
+	for _, rule := range rules {
+		if rule.TableType != "" && rule.TableType != segment.TableType {
+			continue
+		}
+		if rule.Zone != "" && rule.Zone != segment.Zone {
+			continue
+		}
+		if len(rule.TableIDs) == 0 {
+			matched = append(matched, rule)
+			continue
+		}
+		for _, id := range rule.TableIDs {
+			if id == segment.TableID {
+				matched = append(matched, rule)
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].Priority != matched[j].Priority {
+			return matched[i].Priority > matched[j].Priority
+		}
+		return ruleSpecificity(matched[i]) > ruleSpecificity(matched[j])
+	})
+	return matched
+}
+
+func ruleSpecificity(rule models.PricingRule) int {
+	specificity := 0
+	if len(rule.TableIDs) > 0 {
+		specificity += 2
+	}
+	if rule.TableType != "" || rule.Zone != "" {
+		specificity++
+	}
+	return specificity
+}
+
+// The rule in effect at t, or nil for the table's base rate
+func ruleAt(rules []models.PricingRule, t time.Time) *models.PricingRule {
+	for i := range rules {
+		// A window that started yesterday may still be running
+		for _, day := range []time.Time{t, t.AddDate(0, 0, -1)} {
+			start, end, ok := ruleWindow(rules[i], day)
+			if ok && !t.Before(start) && t.Before(end) {
+				return &rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// The window of a rule that opens on the given day
+func ruleWindow(rule models.PricingRule, day time.Time) (time.Time, time.Time, bool) {
+	if len(rule.Weekdays) > 0 {
+		matches := false
+		for _, weekday := range rule.Weekdays {
+			if time.Weekday(weekday) == day.Weekday() {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	startMinutes, err := ParseClock(rule.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	endMinutes, err := ParseClock(rule.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	dayStart := midnight(day)
+	start := dayStart.Add(time.Duration(startMinutes) * time.Minute)
+	end := dayStart.Add(time.Duration(endMinutes) * time.Minute)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, true
+}
+
+// Midnight at the start of t's day, in t's location
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// ParseClock parses HH:MM or HH:MM:SS (as MySQL returns TIME columns) into
+// minutes after midnight; seconds are checked but not counted
+func ParseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	if len(parts) == 3 {
+		seconds, err := strconv.Atoi(parts[2])
+		if err != nil || seconds < 0 || seconds > 59 {
+			return 0, fmt.Errorf("invalid time %q", value)
+		}
+	}
+
+	return hours*60 + minutes, nil
+}
@@ -0,0 +1,151 @@
+package billing
+
+import (
+	"sort"
+	"time"
+
+	"bi-a-management/internal/models"
+)
+
+// A stretch of played time billed at a single hourly rate
+type priceSlice struct {
+	Start      time.Time
+	End        time.Time
+	Minutes    int
+	HourlyRate float64
+	Rule       *models.PricingRule // nil when billed at the table's base rate
+	Amount     float64
+}
+
+// Time played between start and end, excluding pauses. An open pause counts
+// up to end.
+func playedDuration(start, end time.Time, pauses []models.SessionPause) time.Duration {
+	if !end.After(start) {
+		return 0
+	}
+
+	played := end.Sub(start)
+	for _, pause := range pauses {
+		pauseEnd := end
+		if pause.ResumedAt != nil && pause.ResumedAt.Before(end) {
+			pauseEnd = *pause.ResumedAt
+		}
+		pauseStart := pause.PausedAt
+		if pauseStart.Before(start) {
+			pauseStart = start
+		}
+		if pauseEnd.After(pauseStart) {
+			played -= pauseEnd.Sub(pauseStart)
+		}
+	}
+
+	if played < 0 {
+		return 0
+	}
+	return played
+}
+
+// The moment the played time since start reaches minutes, skipping pauses. An
+// open pause is taken to last until now.
+func playedUntil(start time.Time, minutes int, pauses []models.SessionPause, now time.Time) time.Time {
+	t := start.Add(time.Duration(minutes) * time.Minute)
+	for _, pause := range pauses {
+		pauseEnd := now
+		if pause.ResumedAt != nil {
+			pauseEnd = *pause.ResumedAt
+		}
+		pauseStart := pause.PausedAt
+		if pauseStart.Before(start) {
+			pauseStart = start
+		}
+		if !pauseStart.Before(t) || !pauseEnd.After(pauseStart) {
+			continue
+		}
+		t = t.Add(pauseEnd.Sub(pauseStart))
+	}
+	return t
+}
+
+// Cut the played time between start and end into slices of constant rate and
+// spread billedMinutes over them
+func sliceByRules(start, end time.Time, pauses []models.SessionPause, baseRate float64, rules []models.PricingRule, billedMinutes int) []priceSlice {
+	// Every point where the rate or the played state can change
+	cuts := []time.Time{start, end}
+	for _, pause := range pauses {
+		cuts = append(cuts, pause.PausedAt)
+		if pause.ResumedAt != nil {
+			cuts = append(cuts, *pause.ResumedAt)
+		}
+	}
+	// From the day before start, whose window may still be running, through
+	// the day end falls on
+	for day := midnight(start).AddDate(0, 0, -1); !day.After(midnight(end)); day = day.AddDate(0, 0, 1) {
+		for _, rule := range rules {
+			if windowStart, windowEnd, ok := ruleWindow(rule, day); ok {
+				cuts = append(cuts, windowStart, windowEnd)
+			}
+		}
+	}
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].Before(cuts[j]) })
+
+	var slices []priceSlice
+	var seconds []float64
+	for i := 0; i+1 < len(cuts); i++ {
+		from, to := cuts[i], cuts[i+1]
+		if from.Before(start) || to.After(end) || !to.After(from) {
+			continue
+		}
+
+		played := playedDuration(from, to, pauses)
+		if played <= 0 {
+			continue
+		}
+
+		rate := baseRate
+		rule := ruleAt(rules, from)
+		if rule != nil {
+			rate = rule.HourlyRate
+		}
+
+		// Merge with the previous slice when nothing but a pause separates them
+		if n := len(slices); n > 0 && slices[n-1].HourlyRate == rate && sameRule(slices[n-1].Rule, rule) {
+			slices[n-1].End = to
+			seconds[n-1] += played.Seconds()
+			continue
+		}
+
+		slices = append(slices, priceSlice{Start: from, End: to, HourlyRate: rate, Rule: rule})
+		seconds = append(seconds, played.Seconds())
+	}
+
+	if len(slices) == 0 {
+		return []priceSlice{{Start: start, End: end, Minutes: billedMinutes, HourlyRate: baseRate,
+			Amount: (float64(billedMinutes) / 60.0) * baseRate}}
+	}
+
+	// Whole minutes per slice from the running total, so they add up exactly
+	var cumulative float64
+	assigned := 0
+	for i := range slices {
+		cumulative += seconds[i]
+		upTo := int(cumulative / 60)
+		if upTo > billedMinutes || i == len(slices)-1 {
+			upTo = billedMinutes
+		}
+		if upTo < assigned {
+			upTo = assigned
+		}
+		slices[i].Minutes = upTo - assigned
+		slices[i].Amount = (float64(slices[i].Minutes) / 60.0) * slices[i].HourlyRate
+		assigned = upTo
+	}
+
+	return slices
+}
+
+func sameRule(a, b *models.PricingRule) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID
+}
@@ -1,6 +1,9 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+)
 
 type Config struct {
 	DBHost      string
@@ -12,6 +15,53 @@ type Config struct {
 	Port        string
 	GinMode     string
 	FrontendURL string
+
+	// How often the background ticker refreshes session clocks and
+	// flags fixed_time sessions that ran out as overtime, in seconds (must be
+	// positive; anything else falls back to the default)
+	SessionTickSeconds int
+
+	// Billing policy: bill time in blocks of BillingRoundMinutes (0 = per
+	// minute), never less than BillingMinimumMinutes, and round the invoice
+	// total to the nearest BillingRoundAmount VND (0 = no rounding)
+	BillingRoundMinutes   int
+	BillingMinimumMinutes int
+	BillingRoundAmount    int
+
+	// Overtime on fixed_time sessions: played time past the preset is billed
+	// at OvertimeHourlyRate VND (0 = the table's rate) once it exceeds
+	// OvertimeGraceMinutes
+	OvertimeHourlyRate   int
+	OvertimeGraceMinutes int
+
+	// Reservations: a booked table is held for ReservationHoldMinutes before
+	// the booking starts, and released as a no-show ReservationNoShowMinutes
+	// after it
+	ReservationHoldMinutes   int
+	ReservationNoShowMinutes int
+
+	// Minutes a table stays in cleaning after a session ends before it is
+	// available again (0 = free the table straight away)
+	TableCleaningMinutes int
+
+	// Bank account that VietQR codes on invoices pay into: the bank's 6-digit
+	// NAPAS BIN, the account number and holder name, and the prefix of the
+	// transfer note (prefix + invoice ID, e.g. HD1024)
+	VietQRBankBIN         string
+	VietQRAccountNo       string
+	VietQRAccountName     string
+	VietQRReferencePrefix string
+
+	// Loyalty points: members earn LoyaltyEarnPoints for every
+	// LoyaltyEarnUnit VND of a paid invoice, and redeem
+	// LoyaltyPointsPerMinute points for a free minute of table time or one
+	// point per LoyaltyPointValue VND of an order. Points expire
+	// LoyaltyExpiryMonths after they were earned (0 = never).
+	LoyaltyEarnUnit        int
+	LoyaltyEarnPoints      int
+	LoyaltyPointsPerMinute int
+	LoyaltyPointValue      int
+	LoyaltyExpiryMonths    int
 }
 
 func NewConfig() *Config {
@@ -25,6 +75,31 @@ func NewConfig() *Config {
 		Port:        getEnv("PORT", "8080"),
 		GinMode:     getEnv("GIN_MODE", "debug"),
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
+
+		SessionTickSeconds: getEnvPositiveInt("SESSION_TICK_SECONDS", 30),
+
+		BillingRoundMinutes:   getEnvInt("BILLING_ROUND_MINUTES", 0),
+		BillingMinimumMinutes: getEnvInt("BILLING_MINIMUM_MINUTES", 0),
+		BillingRoundAmount:    getEnvInt("BILLING_ROUND_AMOUNT", 0),
+
+		OvertimeHourlyRate:   getEnvInt("OVERTIME_HOURLY_RATE", 0),
+		OvertimeGraceMinutes: getEnvInt("OVERTIME_GRACE_MINUTES", 0),
+
+		ReservationHoldMinutes:   getEnvInt("RESERVATION_HOLD_MINUTES", 30),
+		ReservationNoShowMinutes: getEnvInt("RESERVATION_NO_SHOW_MINUTES", 15),
+
+		TableCleaningMinutes: getEnvInt("TABLE_CLEANING_MINUTES", 0),
+
+		VietQRBankBIN:         getEnv("VIETQR_BANK_BIN", ""),
+		VietQRAccountNo:       getEnv("VIETQR_ACCOUNT_NO", ""),
+		VietQRAccountName:     getEnv("VIETQR_ACCOUNT_NAME", ""),
+		VietQRReferencePrefix: getEnv("VIETQR_REFERENCE_PREFIX", "HD"),
+
+		LoyaltyEarnUnit:        getEnvInt("LOYALTY_EARN_UNIT", 10000),
+		LoyaltyEarnPoints:      getEnvInt("LOYALTY_EARN_POINTS", 1),
+		LoyaltyPointsPerMinute: getEnvInt("LOYALTY_POINTS_PER_MINUTE", 2),
+		LoyaltyPointValue:      getEnvInt("LOYALTY_POINT_VALUE", 500),
+		LoyaltyExpiryMonths:    getEnvInt("LOYALTY_EXPIRY_MONTHS", 12),
 	}
 }
 
@@ -34,3 +109,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvPositiveInt is getEnvInt for settings that must be above zero, such
+// as ticker intervals: zero or a negative value falls back to the default
+func getEnvPositiveInt(key string, defaultValue int) int {
+	if value := getEnvInt(key, defaultValue); value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -10,6 +10,55 @@ func RunMigrations(db *sql.DB) error {
 	// we only need to ensure basic default data exists
 	migrations := []string{
 		ensureDefaultUsers,
+		createSessionTimeAdjustments,
+		createSessionPauses,
+		createSessionSegments,
+		createInvoiceItems,
+		createInvoiceSessions,
+		addInvoiceParentID,
+		createPricingRules,
+		createPricingRuleTables,
+		addInvoicePrepaidAmount,
+		addTableType,
+		createReservations,
+		createWaitlistEntries,
+		addTableZone,
+		addTableDisplayOrder,
+		addTableCleaningUntil,
+		createTableMaintenanceLogs,
+		createTableTypes,
+		createTableZones,
+		addPricingRuleTableType,
+		addPricingRuleZone,
+		seedTableTypes,
+		seedTableZones,
+		createIdempotencyKeys,
+		createInvoicePayments,
+		addInvoicePaidAmount,
+		addInvoicePaidAt,
+		addInvoicePaymentReferenceIndex,
+		createCreditNotes,
+		addInvoiceCreditedAmount,
+		createPromotions,
+		createSessionPromotions,
+		createSessionDiscounts,
+		createInvoiceDiscounts,
+		createMemberTiers,
+		seedMemberTiers,
+		createCustomers,
+		addSessionCustomerID,
+		addInvoiceCustomerID,
+		addInvoiceDiscountKind,
+		markPromotionDiscounts,
+		createWalletTransactions,
+		createLoyaltyPoints,
+		createSessionPointRedemptions,
+		addProductTrackStock,
+		addProductStock,
+		addProductMinStock,
+		createStockMovements,
+		backfillSessionEndTime,
+		backfillSessionDuration,
 	}
 
 	for i, migration := range migrations {
@@ -28,3 +77,531 @@ INSERT IGNORE INTO users (username, password_hash, role) VALUES
 ('admin', '$2a$10$LIrW4F7m.gJDQVN2QnPT5uPDJpAL4yKQB4Fpu/WROwx//YRsB/LrG', 'admin'),
 ('staff', '$2a$10$LIrW4F7m.gJDQVN2QnPT5uPDJpAL4yKQB4Fpu/WROwx//YRsB/LrG', 'staff');
 `
+
+// Audit trail for admin overrides of a session's remaining time
+const createSessionTimeAdjustments = `
+CREATE TABLE IF NOT EXISTS session_time_adjustments (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	session_id INT NOT NULL,
+	old_remaining_minutes INT NOT NULL,
+	new_remaining_minutes INT NOT NULL,
+	reason VARCHAR(255) NULL,
+	adjusted_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_session_time_adjustments_session (session_id)
+);
+`
+
+// Pause intervals of a session; an open pause has resumed_at = NULL
+const createSessionPauses = `
+CREATE TABLE IF NOT EXISTS session_pauses (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	session_id INT NOT NULL,
+	paused_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	resumed_at TIMESTAMP NULL,
+	paused_by INT NOT NULL,
+	resumed_by INT NULL,
+	INDEX idx_session_pauses_session (session_id)
+);
+`
+
+// Closed table segments of a transferred session
+const createSessionSegments = `
+CREATE TABLE IF NOT EXISTS session_segments (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	session_id INT NOT NULL,
+	table_id INT NOT NULL,
+	hourly_rate DECIMAL(10,2) NOT NULL,
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ended_at TIMESTAMP NULL,
+	transferred_by INT NULL,
+	INDEX idx_session_segments_session (session_id)
+);
+`
+
+// Itemized invoice lines (table time per segment, orders)
+const createInvoiceItems = `
+CREATE TABLE IF NOT EXISTS invoice_items (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	invoice_id INT NOT NULL,
+	item_type VARCHAR(30) NOT NULL,
+	description VARCHAR(255) NOT NULL,
+	start_time TIMESTAMP NULL,
+	end_time TIMESTAMP NULL,
+	minutes INT NOT NULL DEFAULT 0,
+	quantity INT NOT NULL DEFAULT 1,
+	unit_price DECIMAL(12,2) NOT NULL DEFAULT 0,
+	amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+	INDEX idx_invoice_items_invoice (invoice_id)
+);
+`
+
+// Sessions billed by an invoice; a merged invoice links several sessions and
+// the unique key stops a session from being billed twice
+const createInvoiceSessions = `
+CREATE TABLE IF NOT EXISTS invoice_sessions (
+	invoice_id INT NOT NULL,
+	session_id INT NOT NULL,
+	PRIMARY KEY (invoice_id, session_id),
+	UNIQUE KEY uq_invoice_sessions_session (session_id)
+);
+`
+
+// Invoices created by splitting another invoice point back to it
+const addInvoiceParentID = `
+ALTER TABLE invoices ADD COLUMN parent_invoice_id INT NULL;
+`
+
+// Time-of-day / weekday rates that override tables.hourly_rate
+const createPricingRules = `
+CREATE TABLE IF NOT EXISTS pricing_rules (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	weekdays VARCHAR(20) NOT NULL DEFAULT '',
+	start_time TIME NOT NULL,
+	end_time TIME NOT NULL,
+	hourly_rate DECIMAL(10,2) NOT NULL,
+	priority INT NOT NULL DEFAULT 0,
+	is_active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+`
+
+// Tables a pricing rule is limited to; no rows means every table
+const createPricingRuleTables = `
+CREATE TABLE IF NOT EXISTS pricing_rule_tables (
+	rule_id INT NOT NULL,
+	table_id INT NOT NULL,
+	PRIMARY KEY (rule_id, table_id)
+);
+`
+
+// Deposit taken when the session started, deducted from the invoice total
+const addInvoicePrepaidAmount = `
+ALTER TABLE invoices ADD COLUMN prepaid_amount DECIMAL(12,2) NOT NULL DEFAULT 0;
+`
+
+// Kind of table (pool, carom, snooker...) so a booking can ask for any table of a type
+const addTableType = `
+ALTER TABLE tables ADD COLUMN table_type VARCHAR(50) NULL;
+`
+
+// Bookings; the table is held for the booking between hold_from and hold_until
+const createReservations = `
+CREATE TABLE IF NOT EXISTS reservations (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	table_id INT NOT NULL,
+	table_type VARCHAR(50) NULL,
+	customer_name VARCHAR(100) NOT NULL,
+	phone VARCHAR(20) NOT NULL,
+	start_time DATETIME NOT NULL,
+	duration_minutes INT NOT NULL,
+	hold_from DATETIME NOT NULL,
+	hold_until DATETIME NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'booked',
+	note VARCHAR(255) NULL,
+	session_id INT NULL,
+	created_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	INDEX idx_reservations_table_time (table_id, start_time),
+	INDEX idx_reservations_status (status)
+);
+`
+
+// Walk-in parties waiting for a table, in arrival order
+const createWaitlistEntries = `
+CREATE TABLE IF NOT EXISTS waitlist_entries (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	customer_name VARCHAR(100) NOT NULL,
+	phone VARCHAR(20) NULL,
+	party_size INT NOT NULL DEFAULT 1,
+	table_type VARCHAR(50) NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+	table_id INT NULL,
+	note VARCHAR(255) NULL,
+	called_at TIMESTAMP NULL,
+	created_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	INDEX idx_waitlist_entries_status (status, created_at)
+);
+`
+
+// Area of the hall a table stands in (ground floor, VIP room...)
+const addTableZone = `
+ALTER TABLE tables ADD COLUMN zone VARCHAR(50) NULL;
+`
+
+// Position of a table on the board
+const addTableDisplayOrder = `
+ALTER TABLE tables ADD COLUMN display_order INT NOT NULL DEFAULT 0;
+`
+
+// When a table put on cleaning after a session goes back to available
+const addTableCleaningUntil = `
+ALTER TABLE tables ADD COLUMN cleaning_until DATETIME NULL;
+`
+
+// Who put a table under maintenance and why; ended_at is NULL while it lasts
+const createTableMaintenanceLogs = `
+CREATE TABLE IF NOT EXISTS table_maintenance_logs (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	table_id INT NOT NULL,
+	reason VARCHAR(255) NOT NULL,
+	started_by INT NOT NULL,
+	started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ended_by INT NULL,
+	ended_at TIMESTAMP NULL,
+	INDEX idx_table_maintenance_logs_table (table_id)
+);
+`
+
+// Kinds of table; tables.table_type holds the code
+const createTableTypes = `
+CREATE TABLE IF NOT EXISTS table_types (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	code VARCHAR(50) NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	default_hourly_rate DECIMAL(10,2) NOT NULL DEFAULT 0,
+	capacity INT NOT NULL DEFAULT 0,
+	display_order INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY uq_table_types_code (code)
+);
+`
+
+// Areas of the hall; tables.zone holds the code
+const createTableZones = `
+CREATE TABLE IF NOT EXISTS table_zones (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	code VARCHAR(50) NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	display_order INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY uq_table_zones_code (code)
+);
+`
+
+// Pricing rules limited to a table type or zone
+const addPricingRuleTableType = `
+ALTER TABLE pricing_rules ADD COLUMN table_type VARCHAR(50) NULL;
+`
+
+const addPricingRuleZone = `
+ALTER TABLE pricing_rules ADD COLUMN zone VARCHAR(50) NULL;
+`
+
+// Set up the types and zones tables already use, taking the lowest rate of
+// a type's tables as its default
+const seedTableTypes = `
+INSERT IGNORE INTO table_types (code, name, default_hourly_rate)
+SELECT table_type, table_type, MIN(hourly_rate) FROM tables
+WHERE table_type IS NOT NULL AND table_type != ''
+GROUP BY table_type;
+`
+
+const seedTableZones = `
+INSERT IGNORE INTO table_zones (code, name)
+SELECT DISTINCT zone, zone FROM tables
+WHERE zone IS NOT NULL AND zone != '';
+`
+
+// Responses of requests sent with an Idempotency-Key, replayed on retries;
+// status_code is NULL while the first request is still running
+const createIdempotencyKeys = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	idem_key VARCHAR(100) NOT NULL,
+	request_hash CHAR(64) NOT NULL,
+	status_code INT NULL,
+	response_body MEDIUMTEXT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP NULL,
+	UNIQUE KEY uq_idempotency_keys_user_key (user_id, idem_key)
+);
+`
+
+// Tenders taken against invoices; a cash tender can exceed what it pays off
+const createInvoicePayments = `
+CREATE TABLE IF NOT EXISTS invoice_payments (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	invoice_id INT NOT NULL,
+	method VARCHAR(20) NOT NULL,
+	amount DECIMAL(12,2) NOT NULL,
+	tendered DECIMAL(12,2) NOT NULL,
+	change_given DECIMAL(12,2) NOT NULL DEFAULT 0,
+	reference VARCHAR(100) NULL,
+	received_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_invoice_payments_invoice (invoice_id),
+	INDEX idx_invoice_payments_created (created_at)
+);
+`
+
+// Sum of the payments on an invoice, kept with it for listings and reports
+const addInvoicePaidAmount = `
+ALTER TABLE invoices ADD COLUMN paid_amount DECIMAL(12,2) NOT NULL DEFAULT 0;
+`
+
+const addInvoicePaidAt = `
+ALTER TABLE invoices ADD COLUMN paid_at TIMESTAMP NULL;
+`
+
+// Bank references are looked up to refuse confirming one transfer twice
+const addInvoicePaymentReferenceIndex = `
+CREATE INDEX idx_invoice_payments_reference ON invoice_payments (reference);
+`
+
+// Voids and partial refunds, approved by an admin
+const createCreditNotes = `
+CREATE TABLE IF NOT EXISTS credit_notes (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	invoice_id INT NOT NULL,
+	kind VARCHAR(10) NOT NULL,
+	amount DECIMAL(12,2) NOT NULL,
+	refund_amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+	refund_method VARCHAR(20) NULL,
+	reason VARCHAR(255) NOT NULL,
+	approved_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_credit_notes_invoice (invoice_id),
+	INDEX idx_credit_notes_created (created_at)
+);
+`
+
+// Sum of the credit notes on an invoice
+const addInvoiceCreditedAmount = `
+ALTER TABLE invoices ADD COLUMN credited_amount DECIMAL(12,2) NOT NULL DEFAULT 0;
+`
+
+// Promotions; a NULL code applies automatically
+const createPromotions = `
+CREATE TABLE IF NOT EXISTS promotions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	code VARCHAR(30) NULL,
+	kind VARCHAR(20) NOT NULL,
+	value DECIMAL(12,2) NOT NULL,
+	max_discount DECIMAL(12,2) NOT NULL DEFAULT 0,
+	target VARCHAR(20) NOT NULL,
+	category VARCHAR(50) NULL,
+	starts_at DATETIME NULL,
+	ends_at DATETIME NULL,
+	usage_limit INT NOT NULL DEFAULT 0,
+	usage_count INT NOT NULL DEFAULT 0,
+	is_active BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY uniq_promotions_code (code)
+);
+`
+
+// Promotion codes entered on a session before it is billed
+const createSessionPromotions = `
+CREATE TABLE IF NOT EXISTS session_promotions (
+	session_id INT NOT NULL,
+	promotion_id INT NOT NULL,
+	added_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (session_id, promotion_id)
+);
+`
+
+// Manual discount a manager granted on a session, at most one per session
+const createSessionDiscounts = `
+CREATE TABLE IF NOT EXISTS session_discounts (
+	session_id INT PRIMARY KEY,
+	amount DECIMAL(12,2) NOT NULL DEFAULT 0,
+	percent DECIMAL(5,2) NOT NULL DEFAULT 0,
+	reason VARCHAR(255) NOT NULL,
+	approved_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// Discounts taken off each invoice, for the discounts report. Name and code
+// are copied so the report survives a promotion being edited or deleted.
+const createInvoiceDiscounts = `
+CREATE TABLE IF NOT EXISTS invoice_discounts (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	invoice_id INT NOT NULL,
+	promotion_id INT NULL,
+	code VARCHAR(30) NULL,
+	name VARCHAR(100) NOT NULL,
+	reason VARCHAR(255) NULL,
+	approved_by INT NULL,
+	amount DECIMAL(12,2) NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_invoice_discounts_invoice (invoice_id),
+	INDEX idx_invoice_discounts_promotion (promotion_id)
+);
+`
+
+// Membership levels and the discount they get on table time
+const createMemberTiers = `
+CREATE TABLE IF NOT EXISTS member_tiers (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	code VARCHAR(20) NOT NULL UNIQUE,
+	name VARCHAR(100) NOT NULL,
+	rate_discount_percent DECIMAL(5,2) NOT NULL DEFAULT 0,
+	display_order INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+`
+
+const seedMemberTiers = `
+INSERT IGNORE INTO member_tiers (code, name, rate_discount_percent, display_order) VALUES
+('standard', 'Thành viên', 0, 0),
+('silver', 'Bạc', 5, 1),
+('gold', 'Vàng', 10, 2);
+`
+
+const createCustomers = `
+CREATE TABLE IF NOT EXISTS customers (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	phone VARCHAR(20) NOT NULL,
+	card_number VARCHAR(30) NULL,
+	tier VARCHAR(20) NOT NULL DEFAULT 'standard',
+	notes TEXT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	UNIQUE KEY uniq_customers_phone (phone),
+	UNIQUE KEY uniq_customers_card (card_number),
+	INDEX idx_customers_name (name)
+);
+`
+
+// Member a session or invoice is for; NULL for walk-ins
+const addSessionCustomerID = `
+ALTER TABLE table_sessions ADD COLUMN customer_id INT NULL, ADD INDEX idx_table_sessions_customer (customer_id);
+`
+
+const addInvoiceCustomerID = `
+ALTER TABLE invoices ADD COLUMN customer_id INT NULL, ADD INDEX idx_invoices_customer (customer_id);
+`
+
+// points, member, promotion or manual
+const addInvoiceDiscountKind = `
+ALTER TABLE invoice_discounts ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'manual';
+`
+
+const markPromotionDiscounts = `
+UPDATE invoice_discounts SET kind = 'promotion' WHERE promotion_id IS NOT NULL AND kind = 'manual';
+`
+
+// Member wallet ledger. Rows are only ever inserted: a customer's balance is
+// the sum of amount, and balance_after records it as of each entry.
+const createWalletTransactions = `
+CREATE TABLE IF NOT EXISTS wallet_transactions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	customer_id INT NOT NULL,
+	kind VARCHAR(20) NOT NULL,
+	amount DECIMAL(12,2) NOT NULL,
+	balance_after DECIMAL(12,2) NOT NULL,
+	method VARCHAR(20) NULL,
+	invoice_id INT NULL,
+	reference VARCHAR(100) NULL,
+	note VARCHAR(255) NULL,
+	created_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_wallet_transactions_customer (customer_id, id),
+	INDEX idx_wallet_transactions_invoice (invoice_id)
+);
+`
+
+// Loyalty points ledger, append-only like the wallet. expires_at is set on
+// earned points only.
+const createLoyaltyPoints = `
+CREATE TABLE IF NOT EXISTS loyalty_points (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	customer_id INT NOT NULL,
+	kind VARCHAR(20) NOT NULL,
+	points INT NOT NULL,
+	balance_after INT NOT NULL,
+	invoice_id INT NULL,
+	session_id INT NULL,
+	expires_at DATETIME NULL,
+	note VARCHAR(255) NULL,
+	created_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_loyalty_points_customer (customer_id, id),
+	INDEX idx_loyalty_points_invoice (invoice_id),
+	INDEX idx_loyalty_points_session (session_id)
+);
+`
+
+// Points spent on a session: free minutes, or an order paid with points
+const createSessionPointRedemptions = `
+CREATE TABLE IF NOT EXISTS session_point_redemptions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	session_id INT NOT NULL,
+	customer_id INT NOT NULL,
+	minutes INT NOT NULL DEFAULT 0,
+	order_id INT NULL,
+	description VARCHAR(255) NOT NULL,
+	points INT NOT NULL,
+	value DECIMAL(12,2) NOT NULL,
+	created_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_session_point_redemptions_session (session_id),
+	UNIQUE KEY uniq_session_point_redemptions_order (order_id)
+);
+`
+
+// Products start untracked so the bar keeps selling until their stock has
+// been counted; tracking is chosen when a product is created or changed later
+const addProductTrackStock = `
+ALTER TABLE products ADD COLUMN track_stock BOOLEAN NOT NULL DEFAULT false;
+`
+
+const addProductStock = `
+ALTER TABLE products ADD COLUMN stock INT NOT NULL DEFAULT 0;
+`
+
+const addProductMinStock = `
+ALTER TABLE products ADD COLUMN min_stock INT NOT NULL DEFAULT 0;
+`
+
+// Every change to a product's stock, append-only
+const createStockMovements = `
+CREATE TABLE IF NOT EXISTS stock_movements (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	product_id INT NOT NULL,
+	kind VARCHAR(20) NOT NULL,
+	quantity INT NOT NULL,
+	stock_after INT NOT NULL,
+	order_id INT NULL,
+	supplier VARCHAR(100) NULL,
+	unit_cost DECIMAL(12,2) NULL,
+	note VARCHAR(255) NULL,
+	created_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	INDEX idx_stock_movements_product (product_id, id),
+	INDEX idx_stock_movements_order (order_id)
+);
+`
+
+// Sessions ended before end_time was stamped: their last update is when they
+// were closed
+const backfillSessionEndTime = `
+UPDATE table_sessions SET end_time = updated_at
+WHERE status IN ('completed', 'expired') AND end_time IS NULL;
+`
+
+// Played minutes of sessions ended before they were stamped, less paused time
+const backfillSessionDuration = `
+UPDATE table_sessions s
+SET s.actual_duration_minutes = GREATEST(0, TIMESTAMPDIFF(MINUTE, s.start_time, s.end_time) - COALESCE((
+	SELECT SUM(TIMESTAMPDIFF(MINUTE, p.paused_at, COALESCE(p.resumed_at, s.end_time)))
+	FROM session_pauses p
+	WHERE p.session_id = s.id
+), 0))
+WHERE s.status IN ('completed', 'expired') AND s.end_time IS NOT NULL AND s.actual_duration_minutes IS NULL;
+`
@@ -40,3 +40,18 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	// In a more complex system, you might maintain a blacklist of tokens
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
+
+// currentUserID reads the user ID that AuthMiddleware stored from the JWT
+func currentUserID(c *gin.Context) (int, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return 0, false
+	}
+
+	id, ok := userID.(float64)
+	if !ok {
+		return 0, false
+	}
+
+	return int(id), true
+}
@@ -31,21 +31,30 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 
 	// Count active sessions using correct table name
 	var activeSessionCount int64
-	h.db.Table("table_sessions").Where("status = ?", "active").Count(&activeSessionCount)
+	h.db.Table("table_sessions").Where("status IN ?", []string{"active", "paused", "overtime"}).Count(&activeSessionCount)
 	stats.ActiveSessions = int(activeSessionCount)
 
 	// Get today's revenue from invoices using correct column name
 	var todayRevenue float64
 	h.db.Table("invoices").
 		Where("DATE(created_at) = ?", today).
+		Where("COALESCE(payment_status, 'pending') != ?", "split").
 		Select("COALESCE(SUM(amount), 0)").
 		Scan(&todayRevenue)
-	stats.TodayRevenue = todayRevenue
+
+	// Net of voids and refunds issued today
+	var todayCredited float64
+	h.db.Table("credit_notes").
+		Where("DATE(created_at) = ?", today).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&todayCredited)
+	stats.TodayRevenue = todayRevenue - todayCredited
 
 	// Count today's invoices using correct table structure
 	var todayInvoiceCount int64
 	h.db.Table("invoices").
 		Where("DATE(created_at) = ?", today).
+		Where("COALESCE(payment_status, 'pending') != ?", "split").
 		Count(&todayInvoiceCount)
 	stats.TodayInvoices = int(todayInvoiceCount)
 
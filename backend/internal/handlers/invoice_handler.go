@@ -13,11 +13,13 @@ import (
 
 type InvoiceHandler struct {
 	invoiceService *services.InvoiceService
+	tableService   *services.TableService
 }
 
-func NewInvoiceHandler(invoiceService *services.InvoiceService) *InvoiceHandler {
+func NewInvoiceHandler(invoiceService *services.InvoiceService, tableService *services.TableService) *InvoiceHandler {
 	return &InvoiceHandler{
 		invoiceService: invoiceService,
+		tableService:   tableService,
 	}
 }
 
@@ -133,3 +135,277 @@ func (h *InvoiceHandler) GetMonthlyReport(c *gin.Context) {
 
 	c.JSON(http.StatusOK, report)
 }
+
+// Merge several sessions into one invoice. Sessions that are still running are
+// ended first.
+func (h *InvoiceHandler) MergeInvoices(c *gin.Context) {
+	var req models.MergeInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createdBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var sessionIDs []int
+	for _, sessionID := range req.SessionIDs {
+		if _, err := h.tableService.GetSessionByID(int(sessionID)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found", "session_id": sessionID})
+			return
+		}
+		sessionIDs = append(sessionIDs, int(sessionID))
+	}
+
+	// Running sessions are ended in the same transaction as the invoice
+	invoice, err := h.tableService.EndSessionsWithInvoice(sessionIDs, createdBy, h.invoiceService)
+	if err != nil {
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, invoice)
+}
+
+// Split one invoice into several
+func (h *InvoiceHandler) SplitInvoice(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req models.SplitInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createdBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	invoices, err := h.invoiceService.SplitInvoice(id, &req, createdBy)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"parent_invoice_id": id,
+		"invoices":          invoices,
+	})
+}
+
+// Take a payment on an invoice, with one or more tenders
+func (h *InvoiceHandler) RecordPayment(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req models.PaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	receivedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	receipt, err := h.invoiceService.RecordPayment(id, &req, receivedBy)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, receipt)
+}
+
+// Get payments taken on an invoice
+func (h *InvoiceHandler) GetPayments(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	payments, err := h.invoiceService.GetPayments(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payments": payments})
+}
+
+// Get the VietQR bank transfer code for an invoice's balance due, as JSON
+// or, with ?format=png, as the image itself
+func (h *InvoiceHandler) GetInvoiceQR(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	qr, err := h.invoiceService.GetInvoiceQR(id)
+	if err != nil {
+		switch err.Error() {
+		case "invoice not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+		case "bank account for VietQR is not configured":
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if c.Query("format") == "png" {
+		c.Data(http.StatusOK, "image/png", qr.Image)
+		return
+	}
+
+	c.JSON(http.StatusOK, qr)
+}
+
+// Mark a bank transfer for an invoice as received
+func (h *InvoiceHandler) ConfirmBankTransfer(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req models.BankTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	receivedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	receipt, err := h.invoiceService.ConfirmBankTransfer(id, &req, receivedBy)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, receipt)
+}
+
+// Void an invoice with a credit note (admin)
+func (h *InvoiceHandler) VoidInvoice(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req models.VoidInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	approvedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	invoice, err := h.invoiceService.VoidInvoice(id, &req, approvedBy)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
+// Refund part of an invoice with a credit note (admin)
+func (h *InvoiceHandler) RefundInvoice(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var req models.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	approvedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	invoice, err := h.invoiceService.RefundInvoice(id, &req, approvedBy)
+	if err != nil {
+		if err.Error() == "invoice not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invoice)
+}
+
+// Get credit notes issued against an invoice
+func (h *InvoiceHandler) GetCreditNotes(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	notes, err := h.invoiceService.GetCreditNotes(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credit_notes": notes})
+}
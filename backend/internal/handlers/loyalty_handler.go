@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LoyaltyHandler struct {
+	loyaltyService *services.LoyaltyService
+}
+
+func NewLoyaltyHandler(loyaltyService *services.LoyaltyService) *LoyaltyHandler {
+	return &LoyaltyHandler{
+		loyaltyService: loyaltyService,
+	}
+}
+
+// Get the earn and burn rates of the points programme
+func (h *LoyaltyHandler) GetRates(c *gin.Context) {
+	rates := h.loyaltyService.GetRates()
+	c.JSON(http.StatusOK, gin.H{
+		"earn_unit":         rates.EarnUnit,
+		"earn_points":       rates.EarnPoints,
+		"points_per_minute": rates.PointsPerMinute,
+		"point_value":       rates.PointValue,
+		"expiry_months":     rates.ExpiryMonths,
+	})
+}
+
+// Get a member's points balance and history
+func (h *LoyaltyHandler) GetPoints(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset parameter"})
+		return
+	}
+
+	account, err := h.loyaltyService.GetPoints(id, limit, offset)
+	if err != nil {
+		if err.Error() == "customer not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// Spend a member's points on their session
+func (h *LoyaltyHandler) RedeemPoints(c *gin.Context) {
+	idStr := c.Param("id")
+	sessionID, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req models.RedeemPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	redemption, err := h.loyaltyService.RedeemPoints(sessionID, &req, userID)
+	if err != nil {
+		if err.Error() == "order not found on this session" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found on this session"})
+			return
+		}
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, redemption)
+}
+
+// Take a redemption back off a session and give the points back
+func (h *LoyaltyHandler) CancelRedemption(c *gin.Context) {
+	idStr := c.Param("id")
+	sessionID, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	redemptionID, err := strconv.Atoi(c.Param("redemptionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redemption ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.loyaltyService.CancelRedemption(sessionID, redemptionID, userID); err != nil {
+		if err.Error() == "redemption not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Redemption not found"})
+			return
+		}
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Redemption cancelled"})
+}
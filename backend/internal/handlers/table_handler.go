@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -11,28 +13,188 @@ import (
 )
 
 type TableHandler struct {
-	tableService   *services.TableService
-	productService *services.ProductService
-	invoiceService *services.InvoiceService
+	tableService    *services.TableService
+	productService  *services.ProductService
+	invoiceService  *services.InvoiceService
+	waitlistService *services.WaitlistService
 }
 
-func NewTableHandler(tableService *services.TableService, productService *services.ProductService, invoiceService *services.InvoiceService) *TableHandler {
+func NewTableHandler(tableService *services.TableService, productService *services.ProductService, invoiceService *services.InvoiceService, waitlistService *services.WaitlistService) *TableHandler {
 	return &TableHandler{
-		tableService:   tableService,
-		productService: productService,
-		invoiceService: invoiceService,
+		tableService:    tableService,
+		productService:  productService,
+		invoiceService:  invoiceService,
+		waitlistService: waitlistService,
 	}
 }
 
 // Get all tables
 func (h *TableHandler) GetAllTables(c *gin.Context) {
-	tables, err := h.tableService.GetAllTables()
+	includeRetired := c.Query("include_retired") == "true"
+
+	tables, err := h.tableService.FindTables(includeRetired, c.Query("type"), c.Query("zone"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// ?group_by=type|zone also returns the tables grouped for the board
+	groupBy := c.Query("group_by")
+	if groupBy == "" {
+		c.JSON(http.StatusOK, gin.H{"tables": tables})
+		return
+	}
+
+	groups, err := h.tableService.GroupTables(tables, groupBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tables": tables, "groups": groups})
+}
+
+// Get table by ID
+func (h *TableHandler) GetTableByID(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	table, err := h.tableService.GetTableByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+// Create table
+func (h *TableHandler) CreateTable(c *gin.Context) {
+	var req models.TableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	table, err := h.tableService.CreateTable(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, table)
+}
+
+// Update table name, type, zone, display order and rate
+func (h *TableHandler) UpdateTable(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	var req models.TableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	table, err := h.tableService.UpdateTable(id, &req)
+	if err != nil {
+		if err.Error() == "table not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+// Retire table
+func (h *TableHandler) RetireTable(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	retiredBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	table, err := h.tableService.RetireTable(id, retiredBy)
+	if err != nil {
+		if err.Error() == "table not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+// Set table status (available, cleaning, maintenance)
+func (h *TableHandler) SetTableStatus(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	var req models.TableStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	table, err := h.tableService.SetTableStatus(id, &req, changedBy)
+	if err != nil {
+		if err.Error() == "table not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, table)
+}
+
+// Get maintenance log of a table
+func (h *TableHandler) GetMaintenanceLogs(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table ID"})
+		return
+	}
+
+	logs, err := h.tableService.GetMaintenanceLogs(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"tables": tables})
+	c.JSON(http.StatusOK, gin.H{"logs": logs})
 }
 
 // Start session
@@ -98,9 +260,12 @@ func (h *TableHandler) GetSessionByID(c *gin.Context) {
 		return
 	}
 
-	// Calculate total order amount
+	// Calculate total order amount; cancelled orders are not billed
 	var totalOrderAmount float64
 	for _, order := range orders {
+		if order.Status == "cancelled" {
+			continue
+		}
 		totalOrderAmount += order.TotalPrice
 	}
 
@@ -113,7 +278,32 @@ func (h *TableHandler) GetSessionByID(c *gin.Context) {
 	c.JSON(http.StatusOK, sessionDetails)
 }
 
-// Update remaining time
+// Get remaining time (derived on the server)
+func (h *TableHandler) GetRemainingTime(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	session, err := h.tableService.GetSessionByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id":              session.ID,
+		"status":                  session.Status,
+		"session_type":            session.SessionType,
+		"start_time":              session.StartTime,
+		"preset_duration_minutes": session.PresetDurationMinutes,
+		"remaining_minutes":       session.RemainingMinutes,
+	})
+}
+
+// Override remaining time (admin only, audited)
 func (h *TableHandler) UpdateRemainingTime(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -123,7 +313,8 @@ func (h *TableHandler) UpdateRemainingTime(c *gin.Context) {
 	}
 
 	var req struct {
-		RemainingMinutes int `json:"remaining_minutes" binding:"required"`
+		RemainingMinutes int    `json:"remaining_minutes" binding:"required,min=1"`
+		Reason           string `json:"reason"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -131,13 +322,22 @@ func (h *TableHandler) UpdateRemainingTime(c *gin.Context) {
 		return
 	}
 
-	err = h.tableService.UpdateRemainingTime(id, req.RemainingMinutes)
+	adjustedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := h.tableService.AdjustRemainingTime(id, req.RemainingMinutes, adjustedBy, req.Reason)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondSessionError(c, err, http.StatusBadRequest)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Time updated successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Time updated successfully",
+		"session": session,
+	})
 }
 
 // End session
@@ -149,49 +349,158 @@ func (h *TableHandler) EndSession(c *gin.Context) {
 		return
 	}
 
-	// Get user ID from JWT for invoice creation
-	userID, exists := c.Get("userID")
-	if !exists {
+	createdBy, ok := currentUserID(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	createdBy, ok := userID.(float64)
+	// End the session and create its invoice; if either fails neither is saved
+	session, invoice, err := h.tableService.EndSession(id, createdBy, h.invoiceService)
+	if err != nil {
+		respondSessionError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Suggest the first waiting party for the freed table
+	suggestion, err := h.waitlistService.SuggestForTable(session.TableID)
+	if err != nil {
+		log.Printf("Waitlist suggestion for table %d failed: %v", session.TableID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Session ended successfully",
+		"session":             session,
+		"invoice_id":          invoice.ID,
+		"total_amount":        invoice.Amount,
+		"invoice":             invoice,
+		"waitlist_suggestion": suggestion,
+	})
+}
+
+// Pause session
+func (h *TableHandler) PauseSession(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	pausedBy, ok := currentUserID(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// End the session
-	session, err := h.tableService.EndSession(id)
+	session, err := h.tableService.PauseSession(id, pausedBy)
+	if err != nil {
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session paused successfully",
+		"session": session,
+	})
+}
+
+// Resume session
+func (h *TableHandler) ResumeSession(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	resumedBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := h.tableService.ResumeSession(id, resumedBy)
+	if err != nil {
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Session resumed successfully",
+		"session": session,
+	})
+}
+
+// Get pause history of a session
+func (h *TableHandler) GetSessionPauses(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	pauses, err := h.tableService.GetSessionPauses(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Automatically create invoice from session
-	invoice, err := h.invoiceService.CreateInvoiceFromSession(id, int(createdBy))
+	c.JSON(http.StatusOK, gin.H{"pauses": pauses})
+}
+
+// Transfer session to another table
+func (h *TableHandler) TransferSession(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		// Log error but don't fail the session end
-		// In production, you might want to handle this differently
-		c.JSON(http.StatusOK, gin.H{
-			"message":        "Session ended successfully",
-			"session":        session,
-			"invoice_error":  err.Error(),
-			"invoice_id":     nil,
-			"total_amount":   0,
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req models.TransferSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transferredBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := h.tableService.TransferSession(id, req.ToTableID, transferredBy)
+	if err != nil {
+		respondSessionError(c, err, http.StatusBadRequest)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message":      "Session ended successfully",
-		"session":      session,
-		"invoice_id":   invoice.ID,
-		"total_amount": invoice.Amount,
+		"message": "Session transferred successfully",
+		"session": session,
 	})
 }
 
+// Get table segments of a session
+func (h *TableHandler) GetSessionSegments(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	segments, err := h.tableService.GetSessionSegments(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"segments": segments})
+}
+
 // Add order to session
 func (h *TableHandler) AddOrderToSession(c *gin.Context) {
 	var req models.AddOrderRequest
@@ -200,15 +509,49 @@ func (h *TableHandler) AddOrderToSession(c *gin.Context) {
 		return
 	}
 
-	orders, err := h.productService.AddOrderToSession(&req)
+	createdBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orders, err := h.productService.AddOrderToSession(&req, createdBy)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondSessionError(c, err, http.StatusBadRequest)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"orders": orders})
 }
 
+// Cancel an order and put it back in stock
+func (h *TableHandler) CancelOrder(c *gin.Context) {
+	idStr := c.Param("orderId")
+	orderID, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	cancelledBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	order, err := h.productService.CancelOrder(orderID, cancelledBy)
+	if err != nil {
+		if err.Error() == "order not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		respondSessionError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
 // Get orders for a session
 func (h *TableHandler) GetSessionOrders(c *gin.Context) {
 	idStr := c.Param("id")
@@ -227,7 +570,7 @@ func (h *TableHandler) GetSessionOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"orders": orders})
 }
 
-// Auto-expire sessions (to be called periodically)
+// Flag sessions that ran out of time as overtime (to be called periodically)
 func (h *TableHandler) AutoExpireSessions(c *gin.Context) {
 	err := h.tableService.AutoExpireSessions()
 	if err != nil {
@@ -235,7 +578,7 @@ func (h *TableHandler) AutoExpireSessions(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Sessions checked and expired if needed"})
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions checked and flagged as overtime if needed"})
 }
 
 // Calculate current amount for a session (realtime)
@@ -247,46 +590,28 @@ func (h *TableHandler) CalculateSessionAmount(c *gin.Context) {
 		return
 	}
 
-	// Get session info
-	session, err := h.tableService.GetSessionByID(sessionID)
+	// Price the session up to now with the same calculator the invoice uses
+	quote, err := h.tableService.QuoteSession(sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Calculate table amount based on session type
-	var tableAmount float64
-	var actualMinutes int
-	
-	if session.SessionType == "fixed_time" {
-		// Fixed time: use preset duration
-		actualMinutes = session.PresetDurationMinutes
-		tableAmount = (float64(actualMinutes) / 60.0) * session.HourlyRate
-	} else {
-		// Open play: calculate from start time to now
-		duration := models.GetTimeNow().Sub(session.StartTime)
-		actualMinutes = int(duration.Minutes())
-		tableAmount = (float64(actualMinutes) / 60.0) * session.HourlyRate
-	}
-
-	// Get orders amount
-	ordersAmount, err := h.productService.GetSessionOrdersTotal(sessionID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Calculate total
-	totalAmount := tableAmount + ordersAmount
-
 	c.JSON(http.StatusOK, gin.H{
-		"session_id":        sessionID,
-		"session_type":      session.SessionType,
-		"actual_minutes":    actualMinutes,
-		"table_amount":      tableAmount,
-		"orders_amount":     ordersAmount,
-		"total_amount":      totalAmount,
-		"hourly_rate":       session.HourlyRate,
+		"session_id":     sessionID,
+		"session_type":   quote.SessionType,
+		"actual_minutes": quote.Minutes,
+		"table_amount":   quote.TableAmount,
+		"orders_amount":  quote.OrdersAmount,
+		"discount":       quote.Discount,
+		"discounts":      quote.Discounts,
+		"rounding":       quote.Rounding,
+		"total_amount":   quote.Total,
+		"prepaid_amount": quote.PrepaidAmount,
+		"balance_due":    quote.BalanceDue,
+		"change_due":     quote.ChangeDue,
+		"hourly_rate":    quote.HourlyRate,
+		"lines":          quote.Lines,
 	})
 }
 
@@ -345,12 +670,17 @@ func (h *TableHandler) UpdateSessionDuration(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    err = h.tableService.AddMinutesToSession(id, req.AddedMinutes)
+    adjustedBy, ok := currentUserID(c)
+    if !ok {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+        return
+    }
+    session, err := h.tableService.AddMinutesToSession(id, req.AddedMinutes, adjustedBy)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondSessionError(c, err, http.StatusBadRequest)
         return
     }
-    c.JSON(http.StatusOK, gin.H{"message": "Duration updated successfully"})
+    c.JSON(http.StatusOK, gin.H{"message": "Duration updated successfully", "session": session})
 }
 
 // Update preset duration
@@ -370,10 +700,31 @@ func (h *TableHandler) UpdatePresetDuration(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    err = h.tableService.UpdatePresetDuration(id, req.PresetDurationMinutes)
+    adjustedBy, ok := currentUserID(c)
+    if !ok {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+        return
+    }
+    session, err := h.tableService.UpdatePresetDuration(id, req.PresetDurationMinutes, adjustedBy)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondSessionError(c, err, http.StatusBadRequest)
         return
     }
-    c.JSON(http.StatusOK, gin.H{"message": "Preset duration updated successfully"})
+    c.JSON(http.StatusOK, gin.H{"message": "Preset duration updated successfully", "session": session})
+}
+
+// Answer a session error: 409 when the session's status does not allow the
+// request (usually because another request changed it first), 404 when it
+// does not exist, otherwise fallback
+func respondSessionError(c *gin.Context, err error, fallback int) {
+	var stateErr *services.SessionStateError
+	if errors.As(err, &stateErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": stateErr.Status})
+		return
+	}
+	if err.Error() == "session not found" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(fallback, gin.H{"error": err.Error()})
 }
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TableTypeHandler struct {
+	tableService *services.TableService
+}
+
+func NewTableTypeHandler(tableService *services.TableService) *TableTypeHandler {
+	return &TableTypeHandler{
+		tableService: tableService,
+	}
+}
+
+// Get all table types
+func (h *TableTypeHandler) GetTableTypes(c *gin.Context) {
+	types, err := h.tableService.GetTableTypes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"table_types": types})
+}
+
+// Create table type
+func (h *TableTypeHandler) CreateTableType(c *gin.Context) {
+	var req models.TableTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tableType, err := h.tableService.CreateTableType(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tableType)
+}
+
+// Update table type, optionally re-pricing its tables
+func (h *TableTypeHandler) UpdateTableType(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table type ID"})
+		return
+	}
+
+	var req models.TableTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tableType, err := h.tableService.UpdateTableType(id, &req)
+	if err != nil {
+		if err.Error() == "table type not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table type not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tableType)
+}
+
+// Delete table type
+func (h *TableTypeHandler) DeleteTableType(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table type ID"})
+		return
+	}
+
+	if err := h.tableService.DeleteTableType(id); err != nil {
+		if err.Error() == "table type not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Table type not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Table type deleted successfully"})
+}
+
+// Get all zones
+func (h *TableTypeHandler) GetZones(c *gin.Context) {
+	zones, err := h.tableService.GetZones()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"zones": zones})
+}
+
+// Create zone
+func (h *TableTypeHandler) CreateZone(c *gin.Context) {
+	var req models.TableZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	zone, err := h.tableService.CreateZone(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, zone)
+}
+
+// Update zone
+func (h *TableTypeHandler) UpdateZone(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid zone ID"})
+		return
+	}
+
+	var req models.TableZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	zone, err := h.tableService.UpdateZone(id, &req)
+	if err != nil {
+		if err.Error() == "zone not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Zone not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, zone)
+}
+
+// Delete zone
+func (h *TableTypeHandler) DeleteZone(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid zone ID"})
+		return
+	}
+
+	if err := h.tableService.DeleteZone(id); err != nil {
+		if err.Error() == "zone not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Zone not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Zone deleted successfully"})
+}
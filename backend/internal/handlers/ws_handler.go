@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"bi-a-management/internal/middleware"
+	"bi-a-management/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type WebSocketHandler struct {
+	hub       *realtime.Hub
+	jwtSecret string
+	upgrader  websocket.Upgrader
+}
+
+func NewWebSocketHandler(hub *realtime.Hub, jwtSecret string) *WebSocketHandler {
+	return &WebSocketHandler{
+		hub:       hub,
+		jwtSecret: jwtSecret,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Same policy as the CORS config: any origin, auth is by JWT
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// Connect upgrades to a WebSocket that receives live table board events.
+// Browsers cannot set headers on a WebSocket handshake, so the JWT may also
+// be passed as the token query parameter.
+func (h *WebSocketHandler) Connect(c *gin.Context) {
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		tokenString = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if tokenString == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
+		return
+	}
+
+	claims, err := middleware.ParseToken(tokenString, h.jwtSecret)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	username, _ := claims["username"].(string)
+	h.hub.Serve(conn, username)
+}
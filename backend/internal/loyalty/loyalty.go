@@ -0,0 +1,107 @@
+// Package loyalty holds the rates of the members' points programme: what a
+// paid invoice earns, what free minutes and orders cost in points, and when
+// earned points expire.
+package loyalty
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"bi-a-management/internal/config"
+)
+
+// Rates are the earn and burn rates of the points programme
+type Rates struct {
+	EarnUnit        int // VND spent to earn EarnPoints
+	EarnPoints      int
+	PointsPerMinute int // cost of one free minute of table time
+	PointValue      int // VND of an order one point pays for
+	ExpiryMonths    int // 0 = points never expire
+}
+
+func NewRates(cfg *config.Config) Rates {
+	return Rates{
+		EarnUnit:        cfg.LoyaltyEarnUnit,
+		EarnPoints:      cfg.LoyaltyEarnPoints,
+		PointsPerMinute: cfg.LoyaltyPointsPerMinute,
+		PointValue:      cfg.LoyaltyPointValue,
+		ExpiryMonths:    cfg.LoyaltyExpiryMonths,
+	}
+}
+
+// Earned is the points an invoice of amount VND earns. Only whole units
+// count: 25,000 VND at 1 point per 10,000 earns 2 points.
+func (r Rates) Earned(amount float64) int {
+	if r.EarnUnit <= 0 || r.EarnPoints <= 0 || amount <= 0 {
+		return 0
+	}
+	return int(math.Floor(amount/float64(r.EarnUnit))) * r.EarnPoints
+}
+
+// MinutesCost is the points for minutes of free table time
+func (r Rates) MinutesCost(minutes int) (int, error) {
+	if r.PointsPerMinute <= 0 {
+		return 0, fmt.Errorf("free minutes are not offered for points")
+	}
+	if minutes <= 0 {
+		return 0, fmt.Errorf("minutes must be positive")
+	}
+	return minutes * r.PointsPerMinute, nil
+}
+
+// OrderCost is the points that pay for an order of amount VND, rounded up
+func (r Rates) OrderCost(amount float64) (int, error) {
+	if r.PointValue <= 0 {
+		return 0, fmt.Errorf("orders cannot be paid with points")
+	}
+	if amount <= 0 {
+		return 0, fmt.Errorf("order has nothing to pay for")
+	}
+	return int(math.Ceil(amount / float64(r.PointValue))), nil
+}
+
+// ExpiresAt is when points earned at a time expire, nil if they never do
+func (r Rates) ExpiresAt(earnedAt time.Time) *time.Time {
+	if r.ExpiryMonths <= 0 {
+		return nil
+	}
+	expiry := earnedAt.AddDate(0, r.ExpiryMonths, 0)
+	return &expiry
+}
+
+// Expiring is how many points to expire when the earned lots past their
+// expiry total expiredEarned and everything else in the ledger (redemptions,
+// reversals and earlier expiries) has taken spent points off the balance.
+// Spending uses up the oldest points first, so only the part of the expired
+// lots that was never spent expires.
+func Expiring(expiredEarned int, spent int) int {
+	if expiredEarned > spent {
+		return expiredEarned - spent
+	}
+	return 0
+}
+
+// Lot is points earned at one time, in the order they were earned
+type Lot struct {
+	Points    int
+	ExpiresAt *time.Time
+}
+
+// NextExpiry finds the first lot, as of now, that still has unspent points
+// and an expiry ahead, and returns how many of its points will expire then.
+// Like Expiring, spent points are taken from the oldest lots first.
+func NextExpiry(lots []Lot, spent int, now time.Time) (int, *time.Time) {
+	for _, lot := range lots {
+		if spent >= lot.Points {
+			spent -= lot.Points
+			continue
+		}
+		left := lot.Points - spent
+		spent = 0
+		if lot.ExpiresAt != nil && lot.ExpiresAt.After(now) {
+			return left, lot.ExpiresAt
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,116 @@
+package loyalty
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEarned(t *testing.T) {
+	rates := Rates{EarnUnit: 10000, EarnPoints: 1}
+	cases := []struct {
+		amount float64
+		want   int
+	}{
+		{0, 0},
+		{9999, 0},
+		{10000, 1},
+		{25000, 2},
+		{187000, 18},
+		{-50000, 0},
+	}
+	for _, tc := range cases {
+		if got := rates.Earned(tc.amount); got != tc.want {
+			t.Errorf("Earned(%.0f) = %d, want %d", tc.amount, got, tc.want)
+		}
+	}
+
+	if got := (Rates{EarnUnit: 10000, EarnPoints: 3}).Earned(25000); got != 6 {
+		t.Errorf("3 points per unit: Earned(25000) = %d, want 6", got)
+	}
+	if got := (Rates{}).Earned(100000); got != 0 {
+		t.Errorf("without an earn rate: Earned = %d, want 0", got)
+	}
+}
+
+func TestCosts(t *testing.T) {
+	rates := Rates{PointsPerMinute: 2, PointValue: 500}
+
+	if got, err := rates.MinutesCost(30); err != nil || got != 60 {
+		t.Errorf("MinutesCost(30) = %d, %v; want 60", got, err)
+	}
+	if _, err := rates.MinutesCost(0); err == nil {
+		t.Error("MinutesCost(0) should fail")
+	}
+
+	if got, err := rates.OrderCost(15000); err != nil || got != 30 {
+		t.Errorf("OrderCost(15000) = %d, %v; want 30", got, err)
+	}
+	if got, err := rates.OrderCost(15200); err != nil || got != 31 {
+		t.Errorf("OrderCost(15200) = %d, %v; want 31 (rounded up)", got, err)
+	}
+
+	if _, err := (Rates{}).MinutesCost(30); err == nil {
+		t.Error("MinutesCost without a rate should fail")
+	}
+	if _, err := (Rates{}).OrderCost(15000); err == nil {
+		t.Error("OrderCost without a rate should fail")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	earned := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+
+	expiry := (Rates{ExpiryMonths: 12}).ExpiresAt(earned)
+	if expiry == nil || !expiry.Equal(time.Date(2025, 1, 31, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("ExpiresAt = %v, want a year later", expiry)
+	}
+	if (Rates{}).ExpiresAt(earned) != nil {
+		t.Error("points should not expire without an expiry period")
+	}
+
+	cases := []struct {
+		expired, spent, want int
+	}{
+		{100, 0, 100},
+		{100, 30, 70},
+		{100, 100, 0},
+		{100, 150, 0},
+		{0, 20, 0},
+	}
+	for _, tc := range cases {
+		if got := Expiring(tc.expired, tc.spent); got != tc.want {
+			t.Errorf("Expiring(%d, %d) = %d, want %d", tc.expired, tc.spent, got, tc.want)
+		}
+	}
+}
+
+func TestNextExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	july := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	september := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	lots := []Lot{{50, &march}, {40, &july}, {30, &september}}
+
+	// The March lot already expired (its 50 points were spent or expired)
+	points, at := NextExpiry(lots, 50, now)
+	if points != 40 || at == nil || !at.Equal(july) {
+		t.Errorf("NextExpiry = %d at %v, want 40 at %v", points, at, july)
+	}
+
+	points, at = NextExpiry(lots, 70, now)
+	if points != 20 || at == nil || !at.Equal(july) {
+		t.Errorf("after spending 20 more: NextExpiry = %d at %v, want 20 at %v", points, at, july)
+	}
+
+	points, at = NextExpiry(lots, 90, now)
+	if points != 30 || at == nil || !at.Equal(september) {
+		t.Errorf("July lot spent: NextExpiry = %d at %v, want 30 at %v", points, at, september)
+	}
+
+	if points, at = NextExpiry(lots, 120, now); points != 0 || at != nil {
+		t.Errorf("all spent: NextExpiry = %d at %v, want none", points, at)
+	}
+	if points, at = NextExpiry([]Lot{{10, nil}}, 0, now); points != 0 || at != nil {
+		t.Errorf("never expiring lot: NextExpiry = %d at %v, want none", points, at)
+	}
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a key is remembered; a key reused after that starts a new request
+const idempotencyKeyTTL = 24 * time.Hour
+
+// Captures the response body so it can be replayed
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a request carrying an Idempotency-Key header run once per
+// user and key. A retry with the same key and body gets the stored response
+// (marked with Idempotent-Replayed: true) instead of repeating the side
+// effect; a retry while the first request is still running gets 409, and the
+// same key on a different request gets 422. Requests without the header are
+// not affected. Server errors are not stored, so they can be retried. It must
+// run after AuthMiddleware.
+func Idempotency(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 100 characters"})
+			c.Abort()
+			return
+		}
+
+		userID := 0
+		if id, ok := c.Get("userID"); ok {
+			if f, ok := id.(float64); ok {
+				userID = int(f)
+			}
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(sum[:])
+
+		// Forget the key once it has expired
+		_, err = db.Exec(
+			"DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ? AND created_at < NOW() - INTERVAL ? SECOND",
+			userID, key, int(idempotencyKeyTTL.Seconds()),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		// Claim the key; the unique index lets only one request have it
+		result, err := db.Exec(`
+			INSERT IGNORE INTO idempotency_keys (user_id, idem_key, request_hash)
+			VALUES (?, ?, ?)
+		`, userID, key, requestHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			replayIdempotentResponse(c, db, userID, key, requestHash)
+			return
+		}
+
+		// Release the key if the handler panics, so the retry is not stuck on 409
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ?", userID, key)
+				panic(recovered)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			_, err = db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idem_key = ?", userID, key)
+		} else {
+			_, err = db.Exec(`
+				UPDATE idempotency_keys SET status_code = ?, response_body = ?, completed_at = NOW()
+				WHERE user_id = ? AND idem_key = ?
+			`, status, writer.body.String(), userID, key)
+		}
+		if err != nil {
+			log.Printf("Failed to save idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// Answer a request whose key was already claimed
+func replayIdempotentResponse(c *gin.Context, db *sql.DB, userID int, key string, requestHash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var body sql.NullString
+	err := db.QueryRow(`
+		SELECT request_hash, status_code, response_body FROM idempotency_keys
+		WHERE user_id = ? AND idem_key = ?
+	`, userID, key).Scan(&storedHash, &status, &body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	if storedHash != requestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		c.Abort()
+		return
+	}
+
+	if !status.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		c.Abort()
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(int(status.Int64), "application/json; charset=utf-8", []byte(body.String))
+	c.Abort()
+}
@@ -0,0 +1,163 @@
+package models
+
+import "time"
+
+// MemberTier is a membership level; members of a tier get RateDiscountPercent
+// off their table time
+type MemberTier struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	Code                string    `gorm:"uniqueIndex" json:"code"`
+	Name                string    `json:"name"`
+	RateDiscountPercent float64   `json:"rate_discount_percent"`
+	DisplayOrder        int       `json:"display_order"`
+	CustomerCount       int       `gorm:"-" json:"customer_count"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Customer is a regular recognised by phone or membership card. Sessions and
+// invoices may link to one; walk-ins keep a free-text name only.
+type Customer struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `json:"name"`
+	Phone         string    `gorm:"uniqueIndex" json:"phone"`
+	CardNumber    string    `json:"card_number,omitempty"`
+	Tier          string    `json:"tier"`
+	TierName      string    `gorm:"-" json:"tier_name,omitempty"` // joined from member_tiers
+	Notes         string    `json:"notes"`
+	WalletBalance float64   `gorm:"-" json:"wallet_balance"` // sum of the wallet ledger
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CustomerHistory is what a customer has played and spent
+type CustomerHistory struct {
+	Customer       *Customer               `json:"customer"`
+	TotalSessions  int                     `json:"total_sessions"`
+	TotalMinutes   int                     `json:"total_minutes"`
+	TotalSpend     float64                 `json:"total_spend"` // invoiced, net of credit notes
+	LastVisit      *time.Time              `json:"last_visit"`
+	FavouriteTable string                  `json:"favourite_table"`
+	Sessions       []CustomerSessionRecord `json:"sessions"`
+}
+
+// CustomerSessionRecord is one past session of a customer
+type CustomerSessionRecord struct {
+	SessionID uint       `json:"session_id"`
+	TableName string     `json:"table_name"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+	Minutes   int        `json:"minutes"`
+	Status    string     `json:"status"`
+	InvoiceID *uint      `json:"invoice_id"`
+	Amount    float64    `json:"amount"`
+}
+
+// WalletTransaction is one entry of a member's wallet ledger. Entries are
+// never changed or deleted; Amount is signed, positive for top-ups, bonus
+// credit and refunds into the wallet, negative for payments out of it.
+type WalletTransaction struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CustomerID   uint      `json:"customer_id"`
+	Kind         string    `json:"kind"` // top_up, bonus, payment, refund
+	Amount       float64   `json:"amount"`
+	BalanceAfter float64   `json:"balance_after"`
+	Method       string    `json:"method,omitempty"` // how a top-up was paid
+	InvoiceID    *uint     `json:"invoice_id,omitempty"`
+	Reference    string    `json:"reference,omitempty"`
+	Note         string    `json:"note,omitempty"`
+	CreatedBy    uint      `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Wallet is a member's balance recomputed from the ledger, with totals per
+// kind of entry. Consistent is false when a stored balance_after disagrees
+// with the running sum, which means the ledger was tampered with.
+type Wallet struct {
+	CustomerID    uint                `json:"customer_id"`
+	Balance       float64             `json:"balance"`
+	TotalTopUps   float64             `json:"total_top_ups"`
+	TotalBonus    float64             `json:"total_bonus"`
+	TotalPayments float64             `json:"total_payments"`
+	TotalRefunds  float64             `json:"total_refunds"`
+	Consistent    bool                `json:"consistent"`
+	Transactions  []WalletTransaction `json:"transactions"` // newest first
+}
+
+// WalletTopUpRequest deposits money into a member's wallet. BonusAmount is
+// extra credit given on top and is recorded as its own entry.
+type WalletTopUpRequest struct {
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	BonusAmount float64 `json:"bonus_amount" binding:"gte=0"`
+	Method      string  `json:"method" binding:"required,oneof=cash bank_transfer card e_wallet"`
+	Reference   string  `json:"reference"`
+	Note        string  `json:"note" binding:"max=255"`
+}
+
+// PointsEntry is one entry of a member's loyalty points ledger. Entries are
+// never changed or deleted; Points is signed, positive when points are earned
+// or given back, negative when they are redeemed, expire or are reversed.
+type PointsEntry struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	CustomerID   uint       `json:"customer_id"`
+	Kind         string     `json:"kind"` // earn, redeem, expire, reversal
+	Points       int        `json:"points"`
+	BalanceAfter int        `json:"balance_after"`
+	InvoiceID    *uint      `json:"invoice_id,omitempty"`
+	SessionID    *uint      `json:"session_id,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // earned points only
+	Note         string     `json:"note,omitempty"`
+	CreatedBy    uint       `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// PointsAccount is a member's points balance recomputed from the ledger,
+// with totals per kind of entry and the next points due to expire
+type PointsAccount struct {
+	CustomerID     uint          `json:"customer_id"`
+	Balance        int           `json:"balance"`
+	TotalEarned    int           `json:"total_earned"`
+	TotalRedeemed  int           `json:"total_redeemed"`
+	TotalExpired   int           `json:"total_expired"`
+	TotalReversed  int           `json:"total_reversed"` // net of points given back
+	ExpiringPoints int           `json:"expiring_points"`
+	NextExpiry     *time.Time    `json:"next_expiry"`
+	Entries        []PointsEntry `json:"entries"` // newest first
+}
+
+// PointRedemption is points a member spent on a session, either on free
+// minutes of table time or to pay for one of the session's orders
+type PointRedemption struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SessionID   uint      `json:"session_id"`
+	CustomerID  uint      `json:"customer_id"`
+	Minutes     int       `json:"minutes,omitempty"`
+	OrderID     *uint     `json:"order_id,omitempty"`
+	Description string    `json:"description"`
+	Points      int       `json:"points"`
+	Value       float64   `json:"value"` // VND taken off the bill
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RedeemPointsRequest spends points on a session: set Minutes for free table
+// time or OrderID to pay for an order
+type RedeemPointsRequest struct {
+	Minutes int  `json:"minutes" binding:"gte=0"`
+	OrderID uint `json:"order_id"`
+}
+
+type MemberTierRequest struct {
+	Code                string  `json:"code" binding:"required,max=20"`
+	Name                string  `json:"name" binding:"required"`
+	RateDiscountPercent float64 `json:"rate_discount_percent" binding:"gte=0,lte=100"`
+	DisplayOrder        int     `json:"display_order"`
+}
+
+type CustomerRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Phone      string `json:"phone" binding:"required"`
+	CardNumber string `json:"card_number"`
+	Tier       string `json:"tier"` // defaults to standard
+	Notes      string `json:"notes"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// StockMovement is one change to a product's stock. Movements are never
+// changed or deleted; Quantity is signed and StockAfter is the stock it left.
+type StockMovement struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ProductID   uint      `json:"product_id"`
+	ProductName string    `gorm:"-" json:"product_name,omitempty"` // joined from products
+	Kind        string    `json:"kind"`                            // order, order_cancel, receipt, adjustment
+	Quantity    int       `json:"quantity"`
+	StockAfter  int       `json:"stock_after"`
+	OrderID     *uint     `json:"order_id,omitempty"`
+	Supplier    string    `json:"supplier,omitempty"`
+	UnitCost    float64   `json:"unit_cost,omitempty"`
+	Note        string    `json:"note,omitempty"` // reason of an adjustment
+	CreatedBy   uint      `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GoodsReceiptRequest records stock delivered by a supplier
+type GoodsReceiptRequest struct {
+	Quantity int     `json:"quantity" binding:"required,min=1"`
+	Supplier string  `json:"supplier" binding:"required,max=100"`
+	UnitCost float64 `json:"unit_cost" binding:"gte=0"`
+	Note     string  `json:"note" binding:"max=255"`
+}
+
+// StockAdjustmentRequest corrects a product's stock by a signed quantity after
+// a count, breakage or anything else that is not a sale or a delivery
+type StockAdjustmentRequest struct {
+	Quantity int    `json:"quantity" binding:"required"`
+	Reason   string `json:"reason" binding:"required,max=255"`
+}
+
+// StockSettingsRequest turns stock tracking on or off for a product and sets
+// its low-stock threshold
+type StockSettingsRequest struct {
+	TrackStock *bool `json:"track_stock" binding:"required"`
+	MinStock   int   `json:"min_stock" binding:"gte=0"`
+}
@@ -27,11 +27,138 @@ type Invoice struct {
 	ServicesDetail      string    `gorm:"type:text" json:"services_detail"` // JSON string
 	ServiceTotal        float64   `json:"service_total"`
 	Discount            float64   `gorm:"default:0" json:"discount"`
-	Status              string    `gorm:"default:pending" json:"status"` // paid, pending, cancelled
+	Status              string    `gorm:"column:payment_status;default:pending" json:"status"` // paid, partially_paid, pending, cancelled (voided), split
+	SessionID           *uint     `json:"session_id"`
+	CustomerName        string    `json:"customer_name"`
+	CustomerID          *uint     `json:"customer_id,omitempty"` // member the invoice is for
+	ParentInvoiceID     *uint     `json:"parent_invoice_id,omitempty"` // set on invoices created by a split
+	PrepaidAmount       float64   `gorm:"default:0" json:"prepaid_amount"`
+	PaidAmount          float64   `gorm:"default:0" json:"paid_amount"` // collected through payments
+	PaidAt              *time.Time `json:"paid_at,omitempty"`
+	CreditedAmount      float64   `gorm:"default:0" json:"credited_amount"` // reversed by credit notes (voids and refunds)
+	BalanceDue          float64   `gorm:"-" json:"balance_due"` // still to collect after the deposit and payments
+	ChangeDue           float64   `gorm:"-" json:"change_due"`  // deposit to refund when it exceeds the total
 	CreatedBy           uint      `json:"created_by"`
 	CreatedAt           time.Time `json:"created_at"`
 	UpdatedAt           time.Time `json:"updated_at"`
 	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Items    []InvoiceItem    `gorm:"-" json:"items,omitempty"`
+	Payments    []InvoicePayment `gorm:"-" json:"payments,omitempty"`
+	CreditNotes []CreditNote     `gorm:"-" json:"credit_notes,omitempty"`
+}
+
+// InvoicePayment is one tender taken against an invoice. Amount is what it
+// paid off; for cash, Tendered can be more and the difference is ChangeGiven.
+type InvoicePayment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	InvoiceID   uint      `json:"invoice_id"`
+	Method      string    `json:"method"` // cash, bank_transfer, card, e_wallet, wallet
+	Amount      float64   `json:"amount"`
+	Tendered    float64   `json:"tendered"`
+	ChangeGiven float64   `json:"change_given"`
+	Reference   string    `json:"reference,omitempty"` // bank or card reference
+	ReceivedBy  uint      `json:"received_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreditNote reverses all (kind void) or part (kind refund) of an invoice.
+// Amount is the revenue taken back, counted on the day the note is issued;
+// RefundAmount is the money handed back to the customer, which for a void is
+// whatever had been collected and may be 0.
+type CreditNote struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	InvoiceID    uint      `json:"invoice_id"`
+	Kind         string    `json:"kind"` // void, refund
+	Amount       float64   `json:"amount"`
+	RefundAmount float64   `json:"refund_amount"`
+	RefundMethod string    `json:"refund_method,omitempty"` // cash, bank_transfer, card, e_wallet, wallet
+	Reason       string    `json:"reason"`
+	ApprovedBy   uint      `json:"approved_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// InvoiceItem is one itemized line of an invoice
+type InvoiceItem struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	InvoiceID   uint       `json:"invoice_id"`
+	ItemType    string     `json:"item_type"` // table_time, overtime, order, discount, split_share, rounding
+	Description string     `json:"description"`
+	StartTime   *time.Time `json:"start_time,omitempty"`
+	EndTime     *time.Time `json:"end_time,omitempty"`
+	Minutes     int        `json:"minutes"`
+	Quantity    int        `json:"quantity"`
+	UnitPrice   float64    `json:"unit_price"`
+	Amount      float64    `json:"amount"`
+	Note        string     `gorm:"-" json:"note,omitempty"` // kitchen or bar note of an order line, printed in services_detail
+}
+
+type MergeInvoiceRequest struct {
+	SessionIDs []uint `json:"session_ids" binding:"required,min=2"`
+}
+
+// SplitInvoiceRequest splits one invoice into several. Mode "equal" uses Parts,
+// "items" assigns every invoice item ID to exactly one part, "amounts" gives a
+// custom amount per part that must add up to the invoice amount. An invoice
+// splits into at most 20 parts.
+type SplitInvoiceRequest struct {
+	Mode    string    `json:"mode" binding:"required,oneof=equal items amounts"`
+	Parts   int       `json:"parts" binding:"omitempty,min=2,max=20"`
+	ItemIDs [][]uint  `json:"item_ids" binding:"omitempty,max=20"`
+	Amounts []float64 `json:"amounts" binding:"omitempty,max=20"`
+}
+
+// PaymentRequest pays an invoice with one or more tenders, applied in order
+type PaymentRequest struct {
+	Tenders []TenderRequest `json:"tenders" binding:"required,min=1,dive"`
+}
+
+type TenderRequest struct {
+	Method    string  `json:"method" binding:"required,oneof=cash bank_transfer card e_wallet wallet"`
+	Amount    float64 `json:"amount" binding:"required,gt=0"` // handed over; cash may exceed the balance
+	Reference string  `json:"reference"`
+}
+
+// PaymentReceipt is the result of a payment: the updated invoice, the
+// tenders just recorded and the change to hand back
+type PaymentReceipt struct {
+	Invoice     *Invoice         `json:"invoice"`
+	Payments    []InvoicePayment `json:"payments"`
+	ChangeGiven float64          `json:"change_given"`
+}
+
+// InvoiceQR is a VietQR bank transfer code for the balance due of an invoice.
+// Image is the PNG, base64 encoded in JSON.
+type InvoiceQR struct {
+	InvoiceID   uint    `json:"invoice_id"`
+	Amount      float64 `json:"amount"`
+	Reference   string  `json:"reference"` // transfer note the customer's bank app pre-fills
+	BankBIN     string  `json:"bank_bin"`
+	AccountNo   string  `json:"account_no"`
+	AccountName string  `json:"account_name"`
+	Payload     string  `json:"payload"`
+	Image       []byte  `json:"image_png"`
+}
+
+// BankTransferRequest confirms a transfer seen on the bank account. Amount
+// defaults to the balance due.
+type BankTransferRequest struct {
+	BankReference string  `json:"bank_reference" binding:"required,max=100"`
+	Amount        float64 `json:"amount" binding:"omitempty,gt=0"`
+}
+
+// VoidInvoiceRequest cancels an invoice. RefundMethod is required when money
+// was already collected on it.
+type VoidInvoiceRequest struct {
+	Reason       string `json:"reason" binding:"required,max=255"`
+	RefundMethod string `json:"refund_method" binding:"omitempty,oneof=cash bank_transfer card e_wallet wallet"`
+}
+
+// RefundRequest hands back part of what was collected on an invoice
+type RefundRequest struct {
+	Amount       float64 `json:"amount" binding:"required,gt=0"`
+	Reason       string  `json:"reason" binding:"required,max=255"`
+	RefundMethod string  `json:"refund_method" binding:"required,oneof=cash bank_transfer card e_wallet wallet"`
 }
 
 type LoginRequest struct {
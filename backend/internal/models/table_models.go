@@ -7,13 +7,60 @@ import (
 
 // Table represents a bi-a table
 type Table struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	Name       string    `gorm:"uniqueIndex" json:"name"`
-	Status     string    `gorm:"default:available" json:"status"` // available, occupied, cleaning, maintenance
-	HourlyRate float64   `json:"hourly_rate"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	Name          string         `gorm:"uniqueIndex" json:"name"`
+	Status        string         `gorm:"default:available" json:"status"` // available, occupied, reserved, cleaning, maintenance, retired
+	TableType     string         `json:"table_type"`
+	Zone          string         `json:"zone"`
+	DisplayOrder  int            `json:"display_order"`
+	HourlyRate    float64        `json:"hourly_rate"`
+	CleaningUntil *time.Time     `json:"cleaning_until,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableMaintenanceLog records a period a table was out of service
+type TableMaintenanceLog struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TableID   uint       `json:"table_id"`
+	Reason    string     `json:"reason"`
+	StartedBy uint       `json:"started_by"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedBy   *uint      `json:"ended_by"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+// TableType is a kind of table (pool, carom, snooker, VIP room). Tables
+// refer to it by code; it carries the default rate for new tables.
+type TableType struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	Code              string    `gorm:"uniqueIndex" json:"code"`
+	Name              string    `json:"name"`
+	DefaultHourlyRate float64   `json:"default_hourly_rate"`
+	Capacity          int       `json:"capacity"` // players a table seats; 0 is not set
+	DisplayOrder      int       `json:"display_order"`
+	TableCount        int       `gorm:"-" json:"table_count"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// TableZone is an area of the hall. Tables refer to it by code.
+type TableZone struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Code         string    `gorm:"uniqueIndex" json:"code"`
+	Name         string    `json:"name"`
+	DisplayOrder int       `json:"display_order"`
+	TableCount   int       `gorm:"-" json:"table_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableGroup is the tables of one type or zone on the board
+type TableGroup struct {
+	Code   string  `json:"code"` // empty for tables without a type or zone
+	Name   string  `json:"name"`
+	Tables []Table `json:"tables"`
 }
 
 // TableSession represents an active playing session
@@ -22,14 +69,17 @@ type TableSession struct {
 	TableID               uint       `json:"table_id"`
 	TableName             string     `gorm:"-" json:"table_name,omitempty"` // joined from tables
 	CustomerName          string     `json:"customer_name"`
+	CustomerID            *uint      `json:"customer_id,omitempty"` // member, nil for walk-ins
 	StartTime             time.Time  `json:"start_time"`
 	EndTime               *time.Time `json:"end_time"`
 	PresetDurationMinutes int        `json:"preset_duration_minutes"`
 	RemainingMinutes      *int       `json:"remaining_minutes"`
+	PausedSeconds         int64      `gorm:"-" json:"paused_seconds"` // summed from session_pauses
+	OvertimeMinutes       int        `gorm:"-" json:"overtime_minutes"` // played past the preset
 	ActualDurationMinutes *int       `json:"actual_duration_minutes"`
 	HourlyRate            float64    `json:"hourly_rate"`
 	PrepaidAmount         float64    `gorm:"default:0" json:"prepaid_amount"`
-	Status                string     `gorm:"default:active" json:"status"` // active, paused, completed, expired
+	Status                string     `gorm:"default:active" json:"status"` // active, paused, overtime, completed, expired
 	SessionType           string     `gorm:"default:fixed_time" json:"session_type"` // fixed_time, open_play
 	CreatedBy             uint       `json:"created_by"`
 	CreatedAt             time.Time  `json:"created_at"`
@@ -48,6 +98,9 @@ type Product struct {
 	Price       float64   `json:"price"`
 	Description string    `gorm:"type:text" json:"description"`
 	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	TrackStock  bool      `gorm:"default:false" json:"track_stock"` // set for counted goods; services stay untracked
+	Stock       int       `json:"stock"` // changed only through stock movements
+	MinStock    int       `binding:"gte=0" json:"min_stock"` // low-stock alert at or below this
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -59,10 +112,12 @@ type SessionOrder struct {
 	SessionID   uint      `json:"session_id"`
 	ProductID   uint      `json:"product_id"`
 	ProductName string    `gorm:"-" json:"product_name,omitempty"` // joined from products
+	Category    string    `gorm:"-" json:"category,omitempty"`     // product category, joined from products
 	Quantity    int       `json:"quantity"`
 	UnitPrice   float64   `json:"unit_price"`
 	TotalPrice  float64   `json:"total_price"`
 	Status      string    `gorm:"default:pending" json:"status"` // pending, preparing, served, cancelled
+	Note        string    `json:"note"`                           // for the kitchen or bar, printed on the invoice
 	OrderedAt   time.Time `gorm:"autoCreateTime" json:"ordered_at"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -73,13 +128,230 @@ type SessionOrder struct {
 	Product Product      `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 }
 
+// SessionPause is one pause interval of a session
+type SessionPause struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SessionID uint       `json:"session_id"`
+	PausedAt  time.Time  `json:"paused_at"`
+	ResumedAt *time.Time `json:"resumed_at"`
+	PausedBy  uint       `json:"paused_by"`
+	ResumedBy *uint      `json:"resumed_by"`
+}
+
+// SessionSegment is the part of a session played on one table. A transfer
+// closes the current segment; the open segment has EndedAt = nil.
+type SessionSegment struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	SessionID  uint       `json:"session_id"`
+	TableID    uint       `json:"table_id"`
+	TableName  string     `gorm:"-" json:"table_name,omitempty"` // joined from tables
+	TableType  string     `gorm:"-" json:"table_type,omitempty"` // joined from tables
+	Zone       string     `gorm:"-" json:"zone,omitempty"`       // joined from tables
+	HourlyRate float64    `json:"hourly_rate"`
+	StartedAt  time.Time  `json:"started_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+}
+
+// PricingRule overrides a table's hourly rate on some weekdays between two
+// times of day. An end time at or before the start time runs past midnight.
+type PricingRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `json:"name"`
+	TableIDs   []uint    `gorm:"-" json:"table_ids"` // table group; empty applies to all tables
+	TableType  string    `json:"table_type"`         // limit to a table type; empty is any type
+	Zone       string    `json:"zone"`               // limit to a zone; empty is any zone
+	Weekdays   []int     `gorm:"-" json:"weekdays"`  // 0 = Sunday ... 6 = Saturday; empty is every day
+	StartTime  string    `json:"start_time"`         // HH:MM
+	EndTime    string    `json:"end_time"`           // HH:MM
+	HourlyRate float64   `json:"hourly_rate"`
+	Priority   int       `json:"priority"` // higher wins when rules overlap
+	IsActive   bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Promotion takes a percentage or a fixed amount off table time, orders or
+// the orders of one product category. A promotion with a code applies to the
+// sessions the code is entered on; one without applies to every session
+// ending in its window.
+type Promotion struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Name        string     `json:"name"`
+	Code        string     `json:"code,omitempty"`
+	Kind        string     `json:"kind"`               // percentage, fixed
+	Value       float64    `json:"value"`              // percent, or VND for fixed
+	MaxDiscount float64    `json:"max_discount"`       // cap on a percentage discount, 0 = no cap
+	Target      string     `json:"target"`             // table_time, orders, category
+	Category    string     `json:"category,omitempty"` // product category when Target is category
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	UsageLimit  int        `json:"usage_limit"` // invoices it may be used on, 0 = unlimited
+	UsageCount  int        `json:"usage_count"`
+	IsActive    bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// SessionDiscount is a manual discount a manager granted on a session,
+// either Amount VND or Percent of the bill left after promotions
+type SessionDiscount struct {
+	SessionID  uint      `json:"session_id"`
+	Amount     float64   `json:"amount"`
+	Percent    float64   `json:"percent"`
+	Reason     string    `json:"reason"`
+	ApprovedBy uint      `json:"approved_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 // Request/Response models
+// Reservation books a table ahead of time. Between HoldFrom and HoldUntil the
+// table is kept for the booking and walk-ins are refused.
+type Reservation struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	TableID         uint      `json:"table_id"`
+	TableName       string    `gorm:"-" json:"table_name,omitempty"` // joined from tables
+	TableType       string    `json:"table_type,omitempty"`          // type asked for, when any table of it would do
+	CustomerName    string    `json:"customer_name"`
+	Phone           string    `json:"phone"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `gorm:"-" json:"end_time"`
+	DurationMinutes int       `json:"duration_minutes"`
+	HoldFrom        time.Time `json:"hold_from"`
+	HoldUntil       time.Time `json:"hold_until"`
+	Status          string    `gorm:"default:booked" json:"status"` // booked, seated, cancelled, no_show
+	Note            string    `json:"note"`
+	SessionID       *uint     `json:"session_id"`
+	CreatedBy       uint      `json:"created_by"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WaitlistEntry is a walk-in party waiting for a table
+type WaitlistEntry struct {
+	ID                   uint       `gorm:"primaryKey" json:"id"`
+	CustomerName         string     `json:"customer_name"`
+	Phone                string     `json:"phone"`
+	PartySize            int        `json:"party_size"`
+	TableType            string     `json:"table_type,omitempty"` // empty = any table
+	Status               string     `gorm:"default:waiting" json:"status"` // waiting, called, seated, removed
+	TableID              *uint      `json:"table_id"`                      // table the party was called to
+	TableName            string     `gorm:"-" json:"table_name,omitempty"`
+	Note                 string     `json:"note"`
+	CalledAt             *time.Time `json:"called_at"`
+	CreatedBy            uint       `json:"created_by"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	Position             int        `gorm:"-" json:"position"`               // 1 = next in line, 0 once called
+	EstimatedWaitMinutes *int       `gorm:"-" json:"estimated_wait_minutes"` // nil when no table end can be predicted
+}
+
 type StartSessionRequest struct {
 	TableID               uint    `json:"table_id" binding:"required"`
-	CustomerName          string  `json:"customer_name" binding:"required"`
+	CustomerName          string  `json:"customer_name"` // required for walk-ins; defaults to the member's name
+	CustomerID            uint    `json:"customer_id"`   // links the session to a member
+	Phone                 string  `json:"phone"`         // looks the member up when customer_id is not given
 	PresetDurationMinutes int     `json:"preset_duration_minutes" binding:"required,min=1,max=480"` // 15 min to 8 hours
 	PrepaidAmount         float64 `json:"prepaid_amount"`
 	SessionType           string  `json:"session_type" binding:"required,oneof=fixed_time open_play"`
+	ReservationID         uint    `json:"reservation_id"` // seats this booking on the table it holds
+}
+
+type ReservationRequest struct {
+	TableID         uint      `json:"table_id"`
+	TableType       string    `json:"table_type"` // used when table_id is not given
+	CustomerName    string    `json:"customer_name" binding:"required"`
+	Phone           string    `json:"phone" binding:"required"`
+	StartTime       time.Time `json:"start_time" binding:"required"`
+	DurationMinutes int       `json:"duration_minutes" binding:"required,min=15,max=480"`
+	Note            string    `json:"note"`
+}
+
+type SeatReservationRequest struct {
+	SessionType           string  `json:"session_type" binding:"omitempty,oneof=fixed_time open_play"`
+	PresetDurationMinutes int     `json:"preset_duration_minutes" binding:"omitempty,min=1,max=480"` // defaults to the booked duration
+	PrepaidAmount         float64 `json:"prepaid_amount"`
+}
+
+type WaitlistRequest struct {
+	CustomerName string `json:"customer_name" binding:"required"`
+	Phone        string `json:"phone"`
+	PartySize    int    `json:"party_size" binding:"omitempty,min=1,max=20"`
+	TableType    string `json:"table_type"`
+	Note         string `json:"note"`
+}
+
+type CallNextRequest struct {
+	TableID uint `json:"table_id"` // call the first party that fits this table
+}
+
+type TableRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	TableType    string  `json:"table_type"`
+	Zone         string  `json:"zone"`
+	DisplayOrder int     `json:"display_order"`
+	HourlyRate   float64 `json:"hourly_rate" binding:"gte=0"` // 0 takes the type's default rate
+}
+
+type TableTypeRequest struct {
+	Code              string  `json:"code" binding:"required"`
+	Name              string  `json:"name" binding:"required"`
+	DefaultHourlyRate float64 `json:"default_hourly_rate" binding:"gte=0"`
+	Capacity          int     `json:"capacity" binding:"gte=0"`
+	DisplayOrder      int     `json:"display_order"`
+	ApplyToTables     bool    `json:"apply_to_tables"` // also set the default rate on the type's tables
+}
+
+type TableZoneRequest struct {
+	Code         string `json:"code" binding:"required"`
+	Name         string `json:"name" binding:"required"`
+	DisplayOrder int    `json:"display_order"`
+}
+
+type TableStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=available cleaning maintenance"`
+	Reason string `json:"reason"` // required when putting a table under maintenance
+}
+
+type PricingRuleRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	TableIDs   []uint  `json:"table_ids"`
+	TableType  string  `json:"table_type"`
+	Zone       string  `json:"zone"`
+	Weekdays   []int   `json:"weekdays" binding:"dive,min=0,max=6"`
+	StartTime  string  `json:"start_time" binding:"required"`
+	EndTime    string  `json:"end_time" binding:"required"`
+	HourlyRate float64 `json:"hourly_rate" binding:"required,gt=0"`
+	Priority   int     `json:"priority"`
+	IsActive   *bool   `json:"is_active"`
+}
+
+type PromotionRequest struct {
+	Name        string     `json:"name" binding:"required"`
+	Code        string     `json:"code" binding:"max=30"`
+	Kind        string     `json:"kind" binding:"required,oneof=percentage fixed"`
+	Value       float64    `json:"value" binding:"required,gt=0"`
+	MaxDiscount float64    `json:"max_discount" binding:"gte=0"`
+	Target      string     `json:"target" binding:"required,oneof=table_time orders category"`
+	Category    string     `json:"category"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	UsageLimit  int        `json:"usage_limit" binding:"gte=0"`
+	IsActive    *bool      `json:"is_active"`
+}
+
+type ApplyPromotionRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ManualDiscountRequest sets either Amount or Percent
+type ManualDiscountRequest struct {
+	Amount  float64 `json:"amount" binding:"gte=0"`
+	Percent float64 `json:"percent" binding:"gte=0,lte=100"`
+	Reason  string  `json:"reason" binding:"required,max=255"`
+}
+
+type TransferSessionRequest struct {
+	ToTableID uint `json:"to_table_id" binding:"required"`
 }
 
 type AddOrderRequest struct {
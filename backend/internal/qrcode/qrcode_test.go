@@ -0,0 +1,138 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"rsc.io/qr/coding"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as version 1-M, from the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("ecc = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	format := []int{
+		0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0,
+	}
+	for mask, want := range format {
+		if got := formatBits(mask); got != want {
+			t.Errorf("formatBits(%d) = %015b, want %015b", mask, got, want)
+		}
+	}
+
+	if got := versionBits(7); got != 0x07C94 {
+		t.Errorf("versionBits(7) = %018b, want %018b", got, 0x07C94)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		size    int
+		version int
+	}{
+		{10, 1},
+		{14, 1},
+		{15, 2},
+		{120, 7},
+		{500, 17},
+	}
+	for _, tc := range cases {
+		code, err := Encode(bytes.Repeat([]byte{'a'}, tc.size))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", tc.size, err)
+		}
+		if code.Version != tc.version || code.Size != tc.version*4+17 {
+			t.Errorf("Encode(%d bytes) = version %d size %d, want version %d", tc.size, code.Version, code.Size, tc.version)
+		}
+
+		// Finder pattern corners and the dark module
+		if !code.Dark(0, 0) || !code.Dark(code.Size-1, 0) || !code.Dark(0, code.Size-1) || !code.Dark(8, code.Size-8) {
+			t.Errorf("version %d: finder patterns or dark module missing", code.Version)
+		}
+		if code.Dark(7, 7) || code.Dark(code.Size-8, 7) {
+			t.Errorf("version %d: separators are not light", code.Version)
+		}
+	}
+
+	if _, err := Encode(make([]byte, 3000)); err == nil {
+		t.Error("Encode(3000 bytes) should fail")
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if side := (code.Size + 8) * 4; img.Bounds().Dx() != side || img.Bounds().Dy() != side {
+		t.Errorf("image is %v, want %dx%d", img.Bounds(), side, side)
+	}
+}
+
+// Every module must match an independent encoder for the same version and
+// mask, so data placement, error correction and format and version
+// information all agree with the standard
+func TestEncodeMatchesReference(t *testing.T) {
+	payloads := []string{
+		"hello",
+		"00020101021238570010A000000727012700069704220113VQRQ0000012340208QRIBFTTA53037045405150005802VN62150811HD0000012363047A1C",
+		strings.Repeat("0123456789abcdef", 10),
+		strings.Repeat("VietQR payment ", 40),
+		strings.Repeat("x", 1500),
+		strings.Repeat("y", 2331),
+	}
+	for _, payload := range payloads {
+		code, err := Encode([]byte(payload))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", len(payload), err)
+		}
+
+		matched := false
+		for mask := 0; mask < 8 && !matched; mask++ {
+			plan, err := coding.NewPlan(coding.Version(code.Version), coding.M, coding.Mask(mask))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := plan.Encode(coding.String(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			matched = sameModules(code, want)
+		}
+		if !matched {
+			t.Errorf("Encode(%d bytes) version %d does not match the reference encoder for any mask", len(payload), code.Version)
+		}
+	}
+}
+
+func sameModules(code *Code, want *coding.Code) bool {
+	if code.Size != want.Size {
+		return false
+	}
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Dark(x, y) != want.Black(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = (pongWait * 9) / 10
+	maxMessageSize = 512
+	sendBufferSize = 64
+)
+
+// Event is a single board update pushed to every connected screen
+type Event struct {
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// Hub keeps track of connected WebSocket clients and fans events out to them
+type Hub struct {
+	clients    map[*client]bool
+	register   chan *client
+	unregister chan *client
+	broadcast  chan []byte
+}
+
+type client struct {
+	hub      *Hub
+	conn     *websocket.Conn
+	send     chan []byte
+	username string
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients:    make(map[*client]bool),
+		register:   make(chan *client),
+		unregister: make(chan *client),
+		broadcast:  make(chan []byte, sendBufferSize),
+	}
+}
+
+// Run dispatches registrations and broadcasts; start it once in a goroutine
+func (h *Hub) Run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.clients[c] = true
+		case c := <-h.unregister:
+			if _, ok := h.clients[c]; ok {
+				delete(h.clients, c)
+				close(c.send)
+			}
+		case message := <-h.broadcast:
+			for c := range h.clients {
+				select {
+				case c.send <- message:
+				default:
+					// Slow client, drop it rather than block the board
+					delete(h.clients, c)
+					close(c.send)
+				}
+			}
+		}
+	}
+}
+
+// Broadcast sends an event to all connected clients. A nil hub is a no-op so
+// services can be used without realtime updates.
+func (h *Hub) Broadcast(eventType string, data interface{}) {
+	if h == nil {
+		return
+	}
+
+	message, err := json.Marshal(Event{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	h.broadcast <- message
+}
+
+// Serve registers an upgraded connection and pumps events to it until it closes
+func (h *Hub) Serve(conn *websocket.Conn, username string) {
+	c := &client{
+		hub:      h,
+		conn:     conn,
+		send:     make(chan []byte, sendBufferSize),
+		username: username,
+	}
+	h.register <- c
+
+	go c.writePump()
+	c.readPump()
+}
+
+// readPump only handles control frames; screens don't send commands
+func (c *client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Event types pushed to the table board
+const (
+	EventSessionStarted     = "session.started"
+	EventSessionEnded       = "session.ended"
+	EventSessionPaused      = "session.paused"
+	EventSessionResumed     = "session.resumed"
+	EventSessionOvertime    = "session.overtime"
+	EventSessionTransferred = "session.transferred"
+	EventSessionTimeUpdated = "session.time_updated"
+	EventOrderAdded         = "order.added"
+	EventOrderCancelled     = "order.cancelled"
+	EventStockLow           = "stock.low"
+	EventTableRateUpdated   = "table.rate_updated"
+	EventTableUpdated       = "table.updated"
+	EventReservationUpdated = "reservation.updated"
+	EventWaitlistUpdated    = "waitlist.updated"
+	EventWaitlistCalled     = "waitlist.called"
+	EventWaitlistSuggested  = "waitlist.suggested"
+)
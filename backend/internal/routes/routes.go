@@ -3,38 +3,58 @@ package routes
 import (
 	"database/sql"
 
+	"bi-a-management/internal/billing"
 	"bi-a-management/internal/config"
 	"bi-a-management/internal/handlers"
+	"bi-a-management/internal/loyalty"
 	"bi-a-management/internal/middleware"
+	"bi-a-management/internal/realtime"
 	"bi-a-management/internal/services"
+	"bi-a-management/internal/vietqr"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(db *sql.DB, cfg *config.Config) *gin.Engine {
+// SetupRoutes wires the HTTP API. The table and reservation services are built
+// by the caller so the background tickers and the handlers share one instance.
+func SetupRoutes(db *sql.DB, cfg *config.Config, hub *realtime.Hub, tableService *services.TableService, reservationService *services.ReservationService) *gin.Engine {
 	router := gin.Default()
 
 	// CORS middleware - Allow all origins for public access
 	router.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: false,
 	}))
 
 	// Initialize services
 	authService := services.NewAuthService(db, cfg.JWTSecret)
-	invoiceService := services.NewInvoiceService(db)
-	tableService := services.NewTableService(db)
-	productService := services.NewProductService(db)
+	billingPolicy := billing.NewPolicy(cfg)
+	loyaltyRates := loyalty.NewRates(cfg)
+	invoiceService := services.NewInvoiceService(db, billingPolicy, vietqr.NewAccount(cfg), loyaltyRates)
+	productService := services.NewProductService(db, hub)
+	pricingService := services.NewPricingService(db)
+	promotionService := services.NewPromotionService(db)
+	customerService := services.NewCustomerService(db)
+	loyaltyService := services.NewLoyaltyService(db, loyaltyRates)
+	waitlistService := services.NewWaitlistService(db, hub, tableService)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	invoiceHandler := handlers.NewInvoiceHandler(invoiceService)
-	tableHandler := handlers.NewTableHandler(tableService, productService, invoiceService)
+	invoiceHandler := handlers.NewInvoiceHandler(invoiceService, tableService)
+	tableHandler := handlers.NewTableHandler(tableService, productService, invoiceService, waitlistService)
 	productHandler := handlers.NewProductHandler(productService)
+	pricingHandler := handlers.NewPricingHandler(pricingService)
+	promotionHandler := handlers.NewPromotionHandler(promotionService)
+	customerHandler := handlers.NewCustomerHandler(customerService)
+	loyaltyHandler := handlers.NewLoyaltyHandler(loyaltyService)
+	tableTypeHandler := handlers.NewTableTypeHandler(tableService)
+	reservationHandler := handlers.NewReservationHandler(reservationService)
+	waitlistHandler := handlers.NewWaitlistHandler(waitlistService)
+	wsHandler := handlers.NewWebSocketHandler(hub, cfg.JWTSecret)
 	
 	// Convert sql.DB to GORM for dashboard handler
 	gormDB, err := services.GetGormDB(db)
@@ -54,6 +74,9 @@ func SetupRoutes(db *sql.DB, cfg *config.Config) *gin.Engine {
 		})
 	})
 
+	// Live table board, authenticated by the JWT inside the handler
+	api.GET("/ws", wsHandler.Connect)
+
 	// Auth routes
 	auth := api.Group("/auth")
 	{
@@ -61,6 +84,9 @@ func SetupRoutes(db *sql.DB, cfg *config.Config) *gin.Engine {
 		auth.POST("/logout", authHandler.Logout)
 	}
 
+	// Money-moving endpoints accept an Idempotency-Key so retries do not repeat them
+	idempotent := middleware.Idempotency(db)
+
 	// Protected routes
 	protected := api.Group("/")
 	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
@@ -69,17 +95,123 @@ func SetupRoutes(db *sql.DB, cfg *config.Config) *gin.Engine {
 		tables := protected.Group("/tables")
 		{
 			tables.GET("/", tableHandler.GetAllTables)
+			tables.POST("/", middleware.RequireRole("admin"), tableHandler.CreateTable)
+			tables.GET("/:id", tableHandler.GetTableByID)
+			tables.PUT("/:id", middleware.RequireRole("admin"), tableHandler.UpdateTable)
+			tables.DELETE("/:id", middleware.RequireRole("admin"), tableHandler.RetireTable)
+			tables.PUT("/:id/status", tableHandler.SetTableStatus)
+			tables.GET("/:id/maintenance", tableHandler.GetMaintenanceLogs)
 			tables.PUT("/:id/rate", tableHandler.UpdateTableRate)
 			tables.GET("/sessions", tableHandler.GetActiveSessions)
-			tables.POST("/sessions", tableHandler.StartSession)
+			tables.POST("/sessions", idempotent, tableHandler.StartSession)
 			tables.GET("/sessions/:id", tableHandler.GetSessionByID)
 			tables.GET("/sessions/:id/orders", tableHandler.GetSessionOrders)
 			tables.GET("/sessions/:id/calculate-amount", tableHandler.CalculateSessionAmount)
-			tables.PUT("/sessions/:id/time", tableHandler.UpdateRemainingTime)
-			tables.POST("/sessions/:id/end", tableHandler.EndSession)
-			tables.POST("/sessions/orders", tableHandler.AddOrderToSession)
+			tables.GET("/sessions/:id/time", tableHandler.GetRemainingTime)
+			tables.PUT("/sessions/:id/time", middleware.RequireRole("admin"), tableHandler.UpdateRemainingTime)
+			tables.POST("/sessions/:id/end", idempotent, tableHandler.EndSession)
+			tables.POST("/sessions/:id/pause", tableHandler.PauseSession)
+			tables.POST("/sessions/:id/resume", tableHandler.ResumeSession)
+			tables.GET("/sessions/:id/pauses", tableHandler.GetSessionPauses)
+			tables.POST("/sessions/:id/transfer", tableHandler.TransferSession)
+			tables.GET("/sessions/:id/segments", tableHandler.GetSessionSegments)
+			tables.POST("/sessions/orders", idempotent, tableHandler.AddOrderToSession)
+			tables.POST("/sessions/orders/:orderId/cancel", tableHandler.CancelOrder)
 			tables.POST("/sessions/expire", tableHandler.AutoExpireSessions)
 			tables.PUT("/sessions/:id/preset-duration", tableHandler.UpdatePresetDuration)
+			tables.POST("/sessions/:id/promotions", promotionHandler.ApplyPromotionCode)
+			tables.DELETE("/sessions/:id/promotions/:promotionId", promotionHandler.RemovePromotionFromSession)
+			tables.PUT("/sessions/:id/discount", middleware.RequireRole("admin"), promotionHandler.SetSessionDiscount)
+			tables.DELETE("/sessions/:id/discount", middleware.RequireRole("admin"), promotionHandler.ClearSessionDiscount)
+			tables.POST("/sessions/:id/redemptions", idempotent, loyaltyHandler.RedeemPoints)
+			tables.DELETE("/sessions/:id/redemptions/:redemptionId", loyaltyHandler.CancelRedemption)
+		}
+
+		// Table types and zones routes (managed by admins)
+		tableTypes := protected.Group("/table-types")
+		{
+			tableTypes.GET("/", tableTypeHandler.GetTableTypes)
+			tableTypes.POST("/", middleware.RequireRole("admin"), tableTypeHandler.CreateTableType)
+			tableTypes.PUT("/:id", middleware.RequireRole("admin"), tableTypeHandler.UpdateTableType)
+			tableTypes.DELETE("/:id", middleware.RequireRole("admin"), tableTypeHandler.DeleteTableType)
+		}
+
+		zones := protected.Group("/zones")
+		{
+			zones.GET("/", tableTypeHandler.GetZones)
+			zones.POST("/", middleware.RequireRole("admin"), tableTypeHandler.CreateZone)
+			zones.PUT("/:id", middleware.RequireRole("admin"), tableTypeHandler.UpdateZone)
+			zones.DELETE("/:id", middleware.RequireRole("admin"), tableTypeHandler.DeleteZone)
+		}
+
+		// Pricing rules routes (managed by admins)
+		pricing := protected.Group("/pricing-rules")
+		{
+			pricing.GET("/", pricingHandler.GetAllRules)
+			pricing.GET("/:id", pricingHandler.GetRuleByID)
+			pricing.POST("/", middleware.RequireRole("admin"), pricingHandler.CreateRule)
+			pricing.PUT("/:id", middleware.RequireRole("admin"), pricingHandler.UpdateRule)
+			pricing.DELETE("/:id", middleware.RequireRole("admin"), pricingHandler.DeleteRule)
+		}
+
+		// Promotions routes (managed by admins)
+		promotions := protected.Group("/promotions")
+		{
+			promotions.GET("/", promotionHandler.GetPromotions)
+			promotions.GET("/:id", promotionHandler.GetPromotionByID)
+			promotions.POST("/", middleware.RequireRole("admin"), promotionHandler.CreatePromotion)
+			promotions.PUT("/:id", middleware.RequireRole("admin"), promotionHandler.UpdatePromotion)
+			promotions.DELETE("/:id", middleware.RequireRole("admin"), promotionHandler.DeletePromotion)
+		}
+
+		// Customer routes
+		customers := protected.Group("/customers")
+		{
+			customers.GET("/", customerHandler.GetCustomers)
+			customers.GET("/lookup", customerHandler.LookupCustomer)
+			customers.GET("/:id", customerHandler.GetCustomerByID)
+			customers.GET("/:id/history", customerHandler.GetCustomerHistory)
+			customers.GET("/:id/wallet", customerHandler.GetWallet)
+			customers.POST("/:id/wallet/top-ups", idempotent, customerHandler.TopUpWallet)
+			customers.GET("/:id/points", loyaltyHandler.GetPoints)
+			customers.POST("/", customerHandler.CreateCustomer)
+			customers.PUT("/:id", customerHandler.UpdateCustomer)
+			customers.DELETE("/:id", middleware.RequireRole("admin"), customerHandler.DeleteCustomer)
+		}
+
+		// Loyalty points programme
+		loyaltyRoutes := protected.Group("/loyalty")
+		{
+			loyaltyRoutes.GET("/rates", loyaltyHandler.GetRates)
+		}
+
+		// Member tier routes (managed by admins)
+		memberTiers := protected.Group("/member-tiers")
+		{
+			memberTiers.GET("/", customerHandler.GetMemberTiers)
+			memberTiers.POST("/", middleware.RequireRole("admin"), customerHandler.CreateMemberTier)
+			memberTiers.PUT("/:id", middleware.RequireRole("admin"), customerHandler.UpdateMemberTier)
+			memberTiers.DELETE("/:id", middleware.RequireRole("admin"), customerHandler.DeleteMemberTier)
+		}
+
+		// Reservations routes
+		reservations := protected.Group("/reservations")
+		{
+			reservations.GET("/", reservationHandler.GetReservations)
+			reservations.POST("/", reservationHandler.CreateReservation)
+			reservations.GET("/:id", reservationHandler.GetReservationByID)
+			reservations.PUT("/:id", reservationHandler.UpdateReservation)
+			reservations.POST("/:id/cancel", reservationHandler.CancelReservation)
+			reservations.POST("/:id/seat", idempotent, reservationHandler.SeatReservation)
+		}
+
+		// Waitlist routes
+		waitlist := protected.Group("/waitlist")
+		{
+			waitlist.GET("/", waitlistHandler.GetWaitlist)
+			waitlist.POST("/", waitlistHandler.AddParty)
+			waitlist.POST("/call-next", waitlistHandler.CallNext)
+			waitlist.DELETE("/:id", waitlistHandler.RemoveEntry)
 		}
 
 		// Products routes
@@ -89,14 +221,28 @@ func SetupRoutes(db *sql.DB, cfg *config.Config) *gin.Engine {
 			products.POST("/", productHandler.CreateProduct)
 			products.PUT("/:id", productHandler.UpdateProduct)
 			products.DELETE("/:id", productHandler.DeleteProduct)
+			products.GET("/low-stock", productHandler.GetLowStockProducts)
+			products.GET("/:id/stock-movements", productHandler.GetStockMovements)
+			products.POST("/:id/stock/receipts", idempotent, productHandler.ReceiveStock)
+			products.POST("/:id/stock/adjustments", middleware.RequireRole("admin"), productHandler.AdjustStock)
+			products.PUT("/:id/stock", middleware.RequireRole("admin"), productHandler.UpdateStockSettings)
 		}
 
 		// Invoices routes
 		invoices := protected.Group("/invoices")
 		{
-			invoices.POST("/", invoiceHandler.CreateInvoice)
+			invoices.POST("/", idempotent, invoiceHandler.CreateInvoice)
 			invoices.GET("/", invoiceHandler.GetAllInvoices)
 			invoices.GET("/:id", invoiceHandler.GetInvoiceByID)
+			invoices.POST("/merge", idempotent, invoiceHandler.MergeInvoices)
+			invoices.POST("/:id/split", invoiceHandler.SplitInvoice)
+			invoices.GET("/:id/payments", invoiceHandler.GetPayments)
+			invoices.POST("/:id/payments", idempotent, invoiceHandler.RecordPayment)
+			invoices.GET("/:id/qr", invoiceHandler.GetInvoiceQR)
+			invoices.POST("/:id/qr/received", idempotent, invoiceHandler.ConfirmBankTransfer)
+			invoices.GET("/:id/credit-notes", invoiceHandler.GetCreditNotes)
+			invoices.POST("/:id/void", middleware.RequireRole("admin"), idempotent, invoiceHandler.VoidInvoice)
+			invoices.POST("/:id/refunds", middleware.RequireRole("admin"), idempotent, invoiceHandler.RefundInvoice)
 		}
 
 		// Reports routes
@@ -104,6 +250,7 @@ func SetupRoutes(db *sql.DB, cfg *config.Config) *gin.Engine {
 		{
 			reports.GET("/daily", invoiceHandler.GetDailyReport)
 			reports.GET("/monthly", invoiceHandler.GetMonthlyReport)
+			reports.GET("/discounts", promotionHandler.GetDiscountReport)
 		}
 
 		// Dashboard routes
@@ -0,0 +1,487 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"bi-a-management/internal/models"
+)
+
+// Tier given to new customers when none is chosen
+const defaultMemberTier = "standard"
+
+type CustomerService struct {
+	db *sql.DB
+}
+
+func NewCustomerService(db *sql.DB) *CustomerService {
+	return &CustomerService{db: db}
+}
+
+const customerColumns = `
+	c.id, c.name, c.phone, COALESCE(c.card_number, ''), c.tier, COALESCE(mt.name, c.tier),
+	COALESCE(c.notes, ''), (SELECT COALESCE(SUM(w.amount), 0) FROM wallet_transactions w WHERE w.customer_id = c.id),
+	c.created_at, c.updated_at
+`
+
+func scanCustomer(row rowScanner) (*models.Customer, error) {
+	var customer models.Customer
+	err := row.Scan(
+		&customer.ID, &customer.Name, &customer.Phone, &customer.CardNumber, &customer.Tier,
+		&customer.TierName, &customer.Notes, &customer.WalletBalance, &customer.CreatedAt, &customer.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// Get member tiers with how many customers each has
+func (s *CustomerService) GetMemberTiers() ([]models.MemberTier, error) {
+	rows, err := s.db.Query(`
+		SELECT mt.id, mt.code, mt.name, mt.rate_discount_percent, mt.display_order,
+		       (SELECT COUNT(*) FROM customers c WHERE c.tier = mt.code), mt.created_at, mt.updated_at
+		FROM member_tiers mt
+		ORDER BY mt.display_order, mt.code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := []models.MemberTier{}
+	for rows.Next() {
+		var tier models.MemberTier
+		err := rows.Scan(
+			&tier.ID, &tier.Code, &tier.Name, &tier.RateDiscountPercent, &tier.DisplayOrder,
+			&tier.CustomerCount, &tier.CreatedAt, &tier.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, rows.Err()
+}
+
+// Create member tier
+func (s *CustomerService) CreateMemberTier(req *models.MemberTierRequest) (*models.MemberTier, error) {
+	req.Code = strings.TrimSpace(req.Code)
+	if err := checkCode(s.db, "member_tiers", req.Code, 0); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO member_tiers (code, name, rate_discount_percent, display_order)
+		VALUES (?, ?, ?, ?)
+	`, req.Code, strings.TrimSpace(req.Name), req.RateDiscountPercent, req.DisplayOrder)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate") {
+			return nil, fmt.Errorf("member tier %s already exists", req.Code)
+		}
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getMemberTier(int(id))
+}
+
+// Update member tier. Renaming the code moves its customers along.
+func (s *CustomerService) UpdateMemberTier(id int, req *models.MemberTierRequest) (*models.MemberTier, error) {
+	req.Code = strings.TrimSpace(req.Code)
+	if err := checkCode(s.db, "member_tiers", req.Code, id); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldCode string
+	err = tx.QueryRow("SELECT code FROM member_tiers WHERE id = ? FOR UPDATE", id).Scan(&oldCode)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("member tier not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE member_tiers SET code = ?, name = ?, rate_discount_percent = ?, display_order = ?
+		WHERE id = ?
+	`, req.Code, strings.TrimSpace(req.Name), req.RateDiscountPercent, req.DisplayOrder, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate") {
+			return nil, fmt.Errorf("member tier %s already exists", req.Code)
+		}
+		return nil, err
+	}
+
+	if req.Code != oldCode {
+		if _, err := tx.Exec("UPDATE customers SET tier = ? WHERE tier = ?", req.Code, oldCode); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getMemberTier(id)
+}
+
+// Delete a member tier nobody is on
+func (s *CustomerService) DeleteMemberTier(id int) error {
+	var code string
+	err := s.db.QueryRow("SELECT code FROM member_tiers WHERE id = ?", id).Scan(&code)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("member tier not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if code == defaultMemberTier {
+		return fmt.Errorf("the %s tier cannot be deleted", defaultMemberTier)
+	}
+
+	var members int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM customers WHERE tier = ?", code).Scan(&members); err != nil {
+		return err
+	}
+	if members > 0 {
+		return fmt.Errorf("member tier has %d customers; move them first", members)
+	}
+
+	_, err = s.db.Exec("DELETE FROM member_tiers WHERE id = ?", id)
+	return err
+}
+
+func (s *CustomerService) getMemberTier(id int) (*models.MemberTier, error) {
+	tiers, err := s.GetMemberTiers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tiers {
+		if tiers[i].ID == uint(id) {
+			return &tiers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("member tier not found")
+}
+
+// Search customers by name, phone or card number
+func (s *CustomerService) GetCustomers(search string, limit int, offset int) ([]models.Customer, error) {
+	query := "SELECT " + customerColumns + " FROM customers c LEFT JOIN member_tiers mt ON mt.code = c.tier"
+	var args []interface{}
+	if search = strings.TrimSpace(search); search != "" {
+		query += " WHERE c.name LIKE ? OR c.phone LIKE ? OR c.card_number = ?"
+		args = append(args, "%"+search+"%", "%"+normalizePhone(search)+"%", search)
+	}
+	query += " ORDER BY c.name, c.id LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := []models.Customer{}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, *customer)
+	}
+
+	return customers, rows.Err()
+}
+
+// Get customer by ID
+func (s *CustomerService) GetCustomerByID(id int) (*models.Customer, error) {
+	return loadCustomer(s.db, "c.id = ?", id)
+}
+
+// Find the member with a phone number or membership card, as typed at the
+// counter when a session starts
+func (s *CustomerService) LookupCustomer(phone string, card string) (*models.Customer, error) {
+	if card = strings.TrimSpace(card); card != "" {
+		return loadCustomer(s.db, "c.card_number = ?", card)
+	}
+	return loadCustomer(s.db, "c.phone = ?", normalizePhone(phone))
+}
+
+// Create customer
+func (s *CustomerService) CreateCustomer(req *models.CustomerRequest) (*models.Customer, error) {
+	if err := validateCustomer(s.db, req); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO customers (name, phone, card_number, tier, notes)
+		VALUES (?, ?, NULLIF(?, ''), ?, NULLIF(?, ''))
+	`, req.Name, req.Phone, req.CardNumber, req.Tier, req.Notes)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate") {
+			return nil, fmt.Errorf("a customer with this phone or card number already exists")
+		}
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCustomerByID(int(id))
+}
+
+// Update customer
+func (s *CustomerService) UpdateCustomer(id int, req *models.CustomerRequest) (*models.Customer, error) {
+	if _, err := s.GetCustomerByID(id); err != nil {
+		return nil, err
+	}
+
+	if err := validateCustomer(s.db, req); err != nil {
+		return nil, err
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE customers SET name = ?, phone = ?, card_number = NULLIF(?, ''), tier = ?, notes = NULLIF(?, '')
+		WHERE id = ?
+	`, req.Name, req.Phone, req.CardNumber, req.Tier, req.Notes, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate") {
+			return nil, fmt.Errorf("a customer with this phone or card number already exists")
+		}
+		return nil, err
+	}
+
+	return s.GetCustomerByID(id)
+}
+
+// Delete customer. Their sessions and invoices keep the name and become
+// walk-ins; their wallet ledger is kept for audit, so the wallet has to be
+// empty first.
+func (s *CustomerService) DeleteCustomer(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	balance, err := walletBalance(tx, uint(id))
+	if err != nil {
+		return err
+	}
+	if math.Abs(balance) >= paymentTolerance {
+		return fmt.Errorf("customer still has %.0f in their wallet", balance)
+	}
+
+	result, err := tx.Exec("DELETE FROM customers WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("customer not found")
+	}
+
+	if _, err := tx.Exec("UPDATE table_sessions SET customer_id = NULL WHERE customer_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE invoices SET customer_id = NULL WHERE customer_id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetCustomerHistory lists a customer's most recent sessions with what each
+// was invoiced, and totals over all of them: sessions, minutes played, spend
+// net of credit notes, last visit and the table they play on most
+func (s *CustomerService) GetCustomerHistory(id int, limit int) (*models.CustomerHistory, error) {
+	customer, err := s.GetCustomerByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &models.CustomerHistory{Customer: customer, Sessions: []models.CustomerSessionRecord{}}
+
+	err = s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(actual_duration_minutes), 0), MAX(start_time)
+		FROM table_sessions WHERE customer_id = ?
+	`, id).Scan(&history.TotalSessions, &history.TotalMinutes, &history.LastVisit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRow(`
+		SELECT COALESCE(SUM(amount - COALESCE(credited_amount, 0)), 0)
+		FROM invoices
+		WHERE customer_id = ? AND `+revenueInvoiceCondition, id).Scan(&history.TotalSpend)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.QueryRow(`
+		SELECT t.name
+		FROM table_sessions s
+		JOIN tables t ON t.id = s.table_id
+		WHERE s.customer_id = ?
+		GROUP BY t.id, t.name
+		ORDER BY COUNT(*) DESC, MAX(s.start_time) DESC
+		LIMIT 1
+	`, id).Scan(&history.FavouriteTable)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT s.id, t.name, s.start_time, s.end_time, COALESCE(s.actual_duration_minutes, 0), s.status,
+		       i.id, COALESCE(i.amount, 0)
+		FROM table_sessions s
+		JOIN tables t ON t.id = s.table_id
+		LEFT JOIN invoice_sessions iss ON iss.session_id = s.id
+		LEFT JOIN invoices i ON i.id = iss.invoice_id
+		WHERE s.customer_id = ?
+		ORDER BY s.start_time DESC
+		LIMIT ?
+	`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.CustomerSessionRecord
+		err := rows.Scan(
+			&record.SessionID, &record.TableName, &record.StartTime, &record.EndTime, &record.Minutes,
+			&record.Status, &record.InvoiceID, &record.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history.Sessions = append(history.Sessions, record)
+	}
+
+	return history, rows.Err()
+}
+
+func loadCustomer(q sessionQueryer, condition string, args ...interface{}) (*models.Customer, error) {
+	customer, err := scanCustomer(q.QueryRow(
+		"SELECT "+customerColumns+" FROM customers c LEFT JOIN member_tiers mt ON mt.code = c.tier WHERE "+condition,
+		args...,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("customer not found")
+	}
+	return customer, err
+}
+
+func validateCustomer(q sessionQueryer, req *models.CustomerRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Phone = normalizePhone(req.Phone)
+	req.CardNumber = strings.TrimSpace(req.CardNumber)
+	req.Notes = strings.TrimSpace(req.Notes)
+	req.Tier = strings.TrimSpace(req.Tier)
+
+	if len(req.Phone) < 8 {
+		return fmt.Errorf("invalid phone number")
+	}
+
+	if req.Tier == "" {
+		req.Tier = defaultMemberTier
+	}
+	var exists bool
+	if err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM member_tiers WHERE code = ?)", req.Tier).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("member tier %s does not exist", req.Tier)
+	}
+	return nil
+}
+
+// Phone numbers are stored as digits in the domestic form, so 0912 345 678,
+// 0912.345.678 and +84912345678 are the same customer
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	normalized := digits.String()
+	if strings.HasPrefix(normalized, "84") && len(normalized) >= 11 {
+		normalized = "0" + normalized[2:]
+	}
+	return normalized
+}
+
+// Work out who a new session is for. A customer ID or a phone that matches a
+// member links the session to them, with their name unless another was
+// given; otherwise the session is a walk-in and needs a name.
+func resolveSessionCustomer(tx *sql.Tx, req *models.StartSessionRequest) (*uint, string, error) {
+	name := strings.TrimSpace(req.CustomerName)
+
+	var customer *models.Customer
+	var err error
+	switch {
+	case req.CustomerID != 0:
+		customer, err = loadCustomer(tx, "c.id = ?", req.CustomerID)
+		if err != nil {
+			return nil, "", err
+		}
+	case req.Phone != "":
+		customer, err = loadCustomer(tx, "c.phone = ?", normalizePhone(req.Phone))
+		if err != nil && err.Error() != "customer not found" {
+			return nil, "", err
+		}
+	}
+
+	if customer == nil {
+		if name == "" {
+			return nil, "", fmt.Errorf("customer_name is required for walk-ins")
+		}
+		return nil, name, nil
+	}
+
+	if name == "" {
+		name = customer.Name
+	}
+	return &customer.ID, name, nil
+}
+
+// Member tier of the customer a session is for, nil for walk-ins
+func loadCustomerTier(q sessionQueryer, customerID *uint) (*models.MemberTier, error) {
+	if customerID == nil {
+		return nil, nil
+	}
+
+	var tier models.MemberTier
+	err := q.QueryRow(`
+		SELECT mt.id, mt.code, mt.name, mt.rate_discount_percent, mt.display_order
+		FROM customers c
+		JOIN member_tiers mt ON mt.code = c.tier
+		WHERE c.id = ?
+	`, *customerID).Scan(&tier.ID, &tier.Code, &tier.Name, &tier.RateDiscountPercent, &tier.DisplayOrder)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tier, nil
+}
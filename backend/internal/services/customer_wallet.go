@@ -0,0 +1,191 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"bi-a-management/internal/models"
+)
+
+// Kinds of wallet ledger entries
+const (
+	WalletTopUp   = "top_up"
+	WalletBonus   = "bonus"
+	WalletPayment = "payment"
+	WalletRefund  = "refund"
+)
+
+// TopUpWallet records money a member deposits, plus any bonus credit given on
+// top as a separate entry, and returns the wallet afterwards
+func (s *CustomerService) TopUpWallet(customerID int, req *models.WalletTopUpRequest, createdBy int) (*models.Wallet, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	topUp := &models.WalletTransaction{
+		CustomerID: uint(customerID),
+		Kind:       WalletTopUp,
+		Amount:     req.Amount,
+		Method:     req.Method,
+		Reference:  strings.TrimSpace(req.Reference),
+		Note:       strings.TrimSpace(req.Note),
+		CreatedBy:  uint(createdBy),
+	}
+	if err := postWalletEntry(tx, topUp); err != nil {
+		return nil, err
+	}
+
+	if req.BonusAmount >= paymentTolerance {
+		bonus := &models.WalletTransaction{
+			CustomerID: uint(customerID),
+			Kind:       WalletBonus,
+			Amount:     req.BonusAmount,
+			Note:       fmt.Sprintf("Bonus for top-up #%d", topUp.ID),
+			CreatedBy:  uint(createdBy),
+		}
+		if err := postWalletEntry(tx, bonus); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetWallet(customerID, 50, 0)
+}
+
+// GetWallet recomputes a member's balance from the whole ledger, checks every
+// stored balance_after against the running sum, and returns a page of the
+// ledger newest first
+func (s *CustomerService) GetWallet(customerID int, limit int, offset int) (*models.Wallet, error) {
+	if _, err := s.GetCustomerByID(customerID); err != nil {
+		return nil, err
+	}
+
+	wallet := &models.Wallet{
+		CustomerID:   uint(customerID),
+		Consistent:   true,
+		Transactions: []models.WalletTransaction{},
+	}
+
+	rows, err := s.db.Query(`
+		SELECT kind, amount, balance_after
+		FROM wallet_transactions
+		WHERE customer_id = ?
+		ORDER BY id
+	`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var amount, balanceAfter float64
+		if err := rows.Scan(&kind, &amount, &balanceAfter); err != nil {
+			return nil, err
+		}
+
+		wallet.Balance += amount
+		if math.Abs(wallet.Balance-balanceAfter) >= paymentTolerance {
+			wallet.Consistent = false
+		}
+
+		switch kind {
+		case WalletTopUp:
+			wallet.TotalTopUps += amount
+		case WalletBonus:
+			wallet.TotalBonus += amount
+		case WalletPayment:
+			wallet.TotalPayments -= amount
+		case WalletRefund:
+			wallet.TotalRefunds += amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	history, err := s.db.Query(`
+		SELECT id, customer_id, kind, amount, balance_after, COALESCE(method, ''), invoice_id,
+		       COALESCE(reference, ''), COALESCE(note, ''), created_by, created_at
+		FROM wallet_transactions
+		WHERE customer_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, customerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer history.Close()
+
+	for history.Next() {
+		var entry models.WalletTransaction
+		err := history.Scan(
+			&entry.ID, &entry.CustomerID, &entry.Kind, &entry.Amount, &entry.BalanceAfter, &entry.Method,
+			&entry.InvoiceID, &entry.Reference, &entry.Note, &entry.CreatedBy, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		wallet.Transactions = append(wallet.Transactions, entry)
+	}
+
+	return wallet, history.Err()
+}
+
+// postWalletEntry appends an entry to a member's wallet ledger in the
+// caller's transaction. The customer row is locked so entries for the same
+// wallet are serialised, and an entry that would overdraw it is refused.
+func postWalletEntry(tx *sql.Tx, entry *models.WalletTransaction) error {
+	var id uint
+	err := tx.QueryRow("SELECT id FROM customers WHERE id = ? FOR UPDATE", entry.CustomerID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("customer not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	balance, err := walletBalance(tx, entry.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	entry.BalanceAfter = balance + entry.Amount
+	if entry.BalanceAfter <= -paymentTolerance {
+		return fmt.Errorf("wallet balance of %.0f is not enough for %.0f", balance, -entry.Amount)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO wallet_transactions
+		(customer_id, kind, amount, balance_after, method, invoice_id, reference, note, created_by)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), ?)
+	`, entry.CustomerID, entry.Kind, entry.Amount, entry.BalanceAfter, entry.Method, entry.InvoiceID,
+		entry.Reference, entry.Note, entry.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = uint(newID)
+	return nil
+}
+
+// A member's wallet balance is the sum of their ledger
+func walletBalance(q sessionQueryer, customerID uint) (float64, error) {
+	var balance float64
+	err := q.QueryRow(
+		"SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions WHERE customer_id = ?",
+		customerID,
+	).Scan(&balance)
+	return balance, err
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"bi-a-management/internal/models"
+)
+
+// VoidInvoice - Hủy hóa đơn (admin duyệt): lập phiếu ghi có (credit note)
+// đảo phần doanh thu còn lại và chuyển hóa đơn sang cancelled. Nếu đã thu
+// tiền (cọc, thanh toán) thì phải chọn hình thức hoàn lại số tiền đó. Điểm
+// tích lũy của hóa đơn bị thu hồi, điểm đã đổi được trả lại.
+func (s *InvoiceService) VoidInvoice(invoiceID int, req *models.VoidInvoiceRequest, approvedBy int) (*models.Invoice, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	credit, err := lockInvoiceForCredit(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch credit.status {
+	case "split":
+		return nil, fmt.Errorf("a split invoice cannot be voided; void its parts instead")
+	case "cancelled":
+		return nil, fmt.Errorf("invoice is already voided")
+	}
+
+	refundAmount := math.Max(credit.refundable(), 0)
+	if refundAmount >= paymentTolerance && req.RefundMethod == "" {
+		return nil, fmt.Errorf("refund_method is required to hand back the %.0f already collected", refundAmount)
+	}
+	if refundAmount < paymentTolerance {
+		refundAmount = 0
+	}
+
+	err = insertCreditNote(tx, invoiceID, "void", math.Max(credit.amount-credit.credited, 0), refundAmount, req.RefundMethod, req.Reason, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if refundAmount > 0 && req.RefundMethod == "wallet" {
+		if err := refundToWallet(tx, credit, invoiceID, refundAmount, req.Reason, approvedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE invoices SET payment_status = 'cancelled', credited_amount = amount WHERE id = ?",
+		invoiceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := reverseInvoicePoints(tx, invoiceID, credit.customerID, approvedBy); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetInvoiceByID(invoiceID)
+}
+
+// RefundInvoice - Hoàn một phần tiền đã thu của hóa đơn (admin duyệt), lập
+// credit note trừ vào doanh thu ngày hoàn. Không hoàn quá số đã thu.
+func (s *InvoiceService) RefundInvoice(invoiceID int, req *models.RefundRequest, approvedBy int) (*models.Invoice, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	credit, err := lockInvoiceForCredit(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if credit.status == "split" || credit.status == "cancelled" {
+		return nil, fmt.Errorf("cannot refund a %s invoice", credit.status)
+	}
+
+	refundable := credit.refundable()
+	if refundable < paymentTolerance {
+		return nil, fmt.Errorf("nothing has been collected on this invoice to refund")
+	}
+	if req.Amount-refundable >= paymentTolerance {
+		return nil, fmt.Errorf("refund of %.0f exceeds the %.0f collected and not yet refunded", req.Amount, refundable)
+	}
+
+	err = insertCreditNote(tx, invoiceID, "refund", req.Amount, req.Amount, req.RefundMethod, req.Reason, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RefundMethod == "wallet" {
+		if err := refundToWallet(tx, credit, invoiceID, req.Amount, req.Reason, approvedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE invoices SET credited_amount = credited_amount + ? WHERE id = ?", req.Amount, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetInvoiceByID(invoiceID)
+}
+
+// GetCreditNotes - Các credit note của một hóa đơn, theo thứ tự lập
+func (s *InvoiceService) GetCreditNotes(invoiceID int) ([]models.CreditNote, error) {
+	rows, err := s.db.Query(`
+		SELECT id, invoice_id, kind, amount, refund_amount, COALESCE(refund_method, ''), reason,
+		       approved_by, created_at
+		FROM credit_notes
+		WHERE invoice_id = ?
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []models.CreditNote
+	for rows.Next() {
+		var note models.CreditNote
+		err := rows.Scan(
+			&note.ID, &note.InvoiceID, &note.Kind, &note.Amount, &note.RefundAmount,
+			&note.RefundMethod, &note.Reason, &note.ApprovedBy, &note.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
+// What a credit note needs to know about the invoice it is issued against
+type invoiceCredit struct {
+	status    string
+	amount    float64
+	collected float64 // deposit kept plus payments
+	credited  float64
+	refunded  float64 // money already handed back by earlier notes
+
+	customerID *uint
+}
+
+// Money collected on the invoice that has not been handed back yet
+func (c invoiceCredit) refundable() float64 {
+	return c.collected - c.refunded
+}
+
+// Lock an invoice for the rest of the transaction and total what has been
+// collected and refunded on it
+func lockInvoiceForCredit(tx *sql.Tx, invoiceID int) (*invoiceCredit, error) {
+	var credit invoiceCredit
+	var prepaid, paid float64
+	err := tx.QueryRow(`
+		SELECT COALESCE(payment_status, 'pending'), amount, COALESCE(prepaid_amount, 0),
+		       COALESCE(paid_amount, 0), COALESCE(credited_amount, 0), customer_id
+		FROM invoices WHERE id = ? FOR UPDATE
+	`, invoiceID).Scan(&credit.status, &credit.amount, &prepaid, &paid, &credit.credited, &credit.customerID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A deposit above the total was handed back as change at checkout
+	credit.collected = math.Min(prepaid, credit.amount) + paid
+
+	err = tx.QueryRow(
+		"SELECT COALESCE(SUM(refund_amount), 0) FROM credit_notes WHERE invoice_id = ?",
+		invoiceID,
+	).Scan(&credit.refunded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &credit, nil
+}
+
+func insertCreditNote(tx *sql.Tx, invoiceID int, kind string, amount float64, refundAmount float64, refundMethod string, reason string, approvedBy int) error {
+	if refundAmount == 0 {
+		refundMethod = ""
+	}
+	_, err := tx.Exec(`
+		INSERT INTO credit_notes (invoice_id, kind, amount, refund_amount, refund_method, reason, approved_by)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+	`, invoiceID, kind, amount, refundAmount, refundMethod, reason, approvedBy)
+	return err
+}
+
+// refundToWallet - Hoàn tiền vào ví thành viên của khách trên hóa đơn
+func refundToWallet(tx *sql.Tx, credit *invoiceCredit, invoiceID int, amount float64, reason string, approvedBy int) error {
+	if credit.customerID == nil {
+		return fmt.Errorf("only invoices linked to a member can be refunded to a wallet")
+	}
+	invoiceRef := uint(invoiceID)
+	return postWalletEntry(tx, &models.WalletTransaction{
+		CustomerID: *credit.customerID,
+		Kind:       WalletRefund,
+		Amount:     amount,
+		InvoiceID:  &invoiceRef,
+		Note:       reason,
+		CreatedBy:  uint(approvedBy),
+	})
+}
+
+// Doanh thu bị credit note đảo, cùng phần tiền giờ và tiền dịch vụ của nó
+type creditedRevenue struct {
+	Total   float64
+	Time    float64
+	Service float64
+}
+
+// Phần tiền giờ / tiền dịch vụ của một credit note, chia theo tỉ lệ tiền giờ và
+// tiền dịch vụ trên hóa đơn gốc (i)
+const (
+	creditedTimeShare    = `COALESCE(cn.amount * i.time_total / NULLIF(i.time_total + i.service_total, 0), 0)`
+	creditedServiceShare = `COALESCE(cn.amount * i.service_total / NULLIF(i.time_total + i.service_total, 0), 0)`
+)
+
+// getCreditNoteSummary - Credit note lập trong kỳ (condition trên
+// cn.created_at): số phiếu hủy và hoàn, doanh thu bị đảo và tiền đã hoàn
+// theo hình thức; trả thêm doanh thu bị đảo (tổng, tiền giờ, tiền dịch vụ)
+// để trừ vào doanh thu kỳ
+func (s *InvoiceService) getCreditNoteSummary(condition string, args ...interface{}) (map[string]interface{}, creditedRevenue, error) {
+	var credited creditedRevenue
+	rows, err := s.db.Query(`
+		SELECT cn.kind, COALESCE(cn.refund_method, ''), COUNT(*),
+		       COALESCE(SUM(cn.amount), 0), COALESCE(SUM(cn.refund_amount), 0),
+		       COALESCE(SUM(`+creditedTimeShare+`), 0), COALESCE(SUM(`+creditedServiceShare+`), 0)
+		FROM credit_notes cn
+		JOIN invoices i ON i.id = cn.invoice_id
+		WHERE `+condition+`
+		GROUP BY cn.kind, COALESCE(cn.refund_method, '')
+	`, args...)
+	if err != nil {
+		return nil, credited, err
+	}
+	defer rows.Close()
+
+	refundsByMethod := make(map[string]float64)
+	var voids, refunds int
+	var refunded float64
+	for rows.Next() {
+		var kind, method string
+		var count int
+		var amount, refundAmount, timeAmount, serviceAmount float64
+		if err := rows.Scan(&kind, &method, &count, &amount, &refundAmount, &timeAmount, &serviceAmount); err != nil {
+			return nil, credited, err
+		}
+		if kind == "void" {
+			voids += count
+		} else {
+			refunds += count
+		}
+		if method != "" {
+			refundsByMethod[method] += refundAmount
+		}
+		credited.Total += amount
+		credited.Time += timeAmount
+		credited.Service += serviceAmount
+		refunded += refundAmount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, credited, err
+	}
+
+	return map[string]interface{}{
+		"voids":                  voids,
+		"refunds":                refunds,
+		"total_credited":         credited.Total,
+		"total_credited_time":    credited.Time,
+		"total_credited_service": credited.Service,
+		"total_refunded":         refunded,
+		"refunds_by_method":      refundsByMethod,
+	}, credited, nil
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"bi-a-management/internal/billing"
+	"bi-a-management/internal/models"
+)
+
+// Số phần tối đa khi chia một hóa đơn
+const maxSplitParts = 20
+
+// Một phần của hóa đơn khi chia
+type splitPart struct {
+	Ratio float64
+	Items []models.InvoiceItem
+}
+
+// CreateInvoiceFromSessionsTx - Gộp nhiều session đã kết thúc vào một hóa đơn,
+// trong transaction của người gọi; trả về ID hóa đơn
+func (s *InvoiceService) CreateInvoiceFromSessionsTx(tx *sql.Tx, sessionIDs []int, createdBy int) (int64, error) {
+	endTime := time.Now()
+	seen := make(map[int]bool)
+	var quotes []*billing.Quote
+
+	for _, sessionID := range sessionIDs {
+		if seen[sessionID] {
+			return 0, fmt.Errorf("session %d is listed twice", sessionID)
+		}
+		seen[sessionID] = true
+
+		var status string
+		err := tx.QueryRow("SELECT status FROM table_sessions WHERE id = ? FOR UPDATE", sessionID).Scan(&status)
+		if err != nil {
+			return 0, fmt.Errorf("session %d not found", sessionID)
+		}
+		if status != SessionCompleted && status != SessionExpired {
+			return 0, &SessionStateError{SessionID: sessionID, Status: status, Action: "invoice"}
+		}
+
+		invoiced, err := isSessionInvoiced(tx, sessionID)
+		if err != nil {
+			return 0, err
+		}
+		if invoiced {
+			return 0, &SessionStateError{SessionID: sessionID, Status: SessionInvoiced, Action: "invoice"}
+		}
+
+		quote, err := s.quoteSession(tx, sessionID, endTime)
+		if err != nil {
+			return 0, err
+		}
+		quotes = append(quotes, quote)
+	}
+
+	return s.createInvoiceFromQuote(tx, billing.Combine(quotes, s.policy), createdBy)
+}
+
+// isSessionInvoiced - Session đã có hóa đơn (kể cả hóa đơn cũ chỉ ghi invoices.session_id)
+func isSessionInvoiced(q sessionQueryer, sessionID int) (bool, error) {
+	var invoiced bool
+	err := q.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM invoice_sessions WHERE session_id = ?)
+		    OR EXISTS(SELECT 1 FROM invoices WHERE session_id = ? AND parent_invoice_id IS NULL)
+	`, sessionID, sessionID).Scan(&invoiced)
+	return invoiced, err
+}
+
+// SplitInvoice - Chia một hóa đơn thành nhiều hóa đơn con. Hóa đơn gốc chuyển
+// sang trạng thái split và không còn được tính vào doanh thu, nên tổng các
+// hóa đơn con luôn khớp với hóa đơn gốc trong báo cáo.
+func (s *InvoiceService) SplitInvoice(invoiceID int, req *models.SplitInvoiceRequest, createdBy int) ([]*models.Invoice, error) {
+	invoice, err := s.GetInvoiceByID(invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("invoice not found")
+	}
+
+	if invoice.Status != "pending" {
+		return nil, fmt.Errorf("only pending invoices can be split")
+	}
+
+	var parts []splitPart
+	switch req.Mode {
+	case "equal":
+		if req.Parts < 2 || req.Parts > maxSplitParts {
+			return nil, fmt.Errorf("parts must be between 2 and %d", maxSplitParts)
+		}
+		for i := 0; i < req.Parts; i++ {
+			parts = append(parts, splitPart{Ratio: 1.0 / float64(req.Parts)})
+		}
+
+	case "amounts":
+		if len(req.Amounts) < 2 || len(req.Amounts) > maxSplitParts {
+			return nil, fmt.Errorf("between 2 and %d amounts are required", maxSplitParts)
+		}
+		var total float64
+		for _, amount := range req.Amounts {
+			if amount <= 0 {
+				return nil, fmt.Errorf("amounts must be positive")
+			}
+			total += amount
+		}
+		if math.Abs(total-invoice.Amount) >= 1 {
+			return nil, fmt.Errorf("amounts add up to %.0f but the invoice is %.0f", total, invoice.Amount)
+		}
+		for _, amount := range req.Amounts {
+			parts = append(parts, splitPart{Ratio: amount / total})
+		}
+
+	case "items":
+		parts, err = splitPartsByItems(invoice, req.ItemIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ratios := make([]float64, len(parts))
+	for i, part := range parts {
+		ratios[i] = part.Ratio
+	}
+	amounts := allocateVND(invoice.Amount, ratios)
+	if req.Mode == "items" {
+		// Mỗi phần trả đúng tổng các dòng của nó, kể cả phần giảm giá được chia
+		for i, part := range parts {
+			amounts[i] = 0
+			for _, item := range part.Items {
+				amounts[i] += item.Amount
+			}
+		}
+	}
+	timeTotals := allocateVND(invoice.TimeTotal, ratios)
+	serviceTotals := allocateVND(invoice.ServiceTotal, ratios)
+	discounts := allocateVND(invoice.Discount, ratios)
+	prepaids := allocateVND(invoice.PrepaidAmount, ratios)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Khóa hóa đơn gốc để hai người không chia cùng lúc
+	var status string
+	var credited float64
+	err = tx.QueryRow(
+		"SELECT COALESCE(payment_status, 'pending'), COALESCE(credited_amount, 0) FROM invoices WHERE id = ? FOR UPDATE",
+		invoiceID,
+	).Scan(&status, &credited)
+	if err != nil {
+		return nil, err
+	}
+	if status != "pending" {
+		return nil, fmt.Errorf("only pending invoices can be split")
+	}
+	if credited > 0 {
+		return nil, fmt.Errorf("an invoice with refunds cannot be split")
+	}
+
+	var childIDs []int64
+	for i, part := range parts {
+		timeTotal, serviceTotal := timeTotals[i], serviceTotals[i]
+		items := part.Items
+		if req.Mode == "items" {
+			timeTotal, serviceTotal = 0, 0
+			for _, item := range items {
+				switch {
+				case item.ItemType == "table_time" || item.ItemType == "overtime":
+					timeTotal += item.Amount
+				case isSplitAdjustment(item):
+					// Giảm giá và làm tròn nằm trong số tiền, không tính vào tiền giờ hay dịch vụ
+				default:
+					serviceTotal += item.Amount
+				}
+			}
+		} else {
+			items = []models.InvoiceItem{{
+				ItemType:    "split_share",
+				Description: fmt.Sprintf("Chia hóa đơn #%d (%d/%d)", invoiceID, i+1, len(parts)),
+				Quantity:    1,
+				UnitPrice:   amounts[i],
+				Amount:      amounts[i],
+			}}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO invoices (
+				amount, table_amount, orders_amount, discount_amount,
+				table_name, start_time, end_time, play_duration_minutes,
+				hourly_rate, time_total, services_detail, service_total,
+				discount, session_id, customer_name, customer_id, prepaid_amount, payment_status, parent_invoice_id, created_by
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?, ?)
+		`, amounts[i], timeTotal, serviceTotal, discounts[i],
+			invoice.TableName, invoice.StartTime, invoice.EndTime, invoice.PlayDurationMinutes,
+			invoice.HourlyRate, timeTotal, invoice.ServicesDetail, serviceTotal,
+			discounts[i], invoice.SessionID, invoice.CustomerName, invoice.CustomerID, prepaids[i], invoiceID, createdBy,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create split invoice: %v", err)
+		}
+
+		childID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := insertInvoiceItems(tx, childID, items); err != nil {
+			return nil, fmt.Errorf("failed to create invoice items: %v", err)
+		}
+		childIDs = append(childIDs, childID)
+	}
+
+	_, err = tx.Exec("UPDATE invoices SET payment_status = 'split' WHERE id = ?", invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var invoices []*models.Invoice
+	for _, childID := range childIDs {
+		child, err := s.GetInvoiceByID(int(childID))
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, child)
+	}
+
+	return invoices, nil
+}
+
+// isSplitAdjustment - Dòng giảm giá hoặc làm tròn: không gán cho phần nào mà
+// được chia cho các phần theo tỉ lệ
+func isSplitAdjustment(item models.InvoiceItem) bool {
+	return item.Amount <= 0 || item.ItemType == "rounding"
+}
+
+// Mỗi dòng tính tiền của hóa đơn phải thuộc đúng một phần. Tỉ lệ của một phần là
+// phần của nó trong tổng các dòng tính tiền; các dòng giảm giá và làm tròn
+// được chia theo tỉ lệ đó.
+func splitPartsByItems(invoice *models.Invoice, groups [][]uint) ([]splitPart, error) {
+	if len(groups) < 2 || len(groups) > maxSplitParts {
+		return nil, fmt.Errorf("between 2 and %d item groups are required", maxSplitParts)
+	}
+	if len(invoice.Items) == 0 {
+		return nil, fmt.Errorf("invoice has no itemized lines")
+	}
+
+	byID := make(map[uint]models.InvoiceItem)
+	var adjustments []models.InvoiceItem
+	var chargedTotal float64
+	for _, item := range invoice.Items {
+		if isSplitAdjustment(item) {
+			adjustments = append(adjustments, item)
+			continue
+		}
+		byID[item.ID] = item
+		chargedTotal += item.Amount
+	}
+
+	adjustmentIDs := make(map[uint]bool)
+	for _, item := range adjustments {
+		adjustmentIDs[item.ID] = true
+	}
+
+	assigned := make(map[uint]bool)
+	var parts []splitPart
+	for _, group := range groups {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("item groups must not be empty")
+		}
+
+		var part splitPart
+		var gross float64
+		for _, itemID := range group {
+			if adjustmentIDs[itemID] {
+				return nil, fmt.Errorf("item %d is a discount or rounding line and is shared out pro rata", itemID)
+			}
+			item, ok := byID[itemID]
+			if !ok {
+				return nil, fmt.Errorf("item %d does not belong to invoice %d", itemID, invoice.ID)
+			}
+			if assigned[itemID] {
+				return nil, fmt.Errorf("item %d is assigned twice", itemID)
+			}
+			assigned[itemID] = true
+			part.Items = append(part.Items, item)
+			gross += item.Amount
+		}
+
+		part.Ratio = gross / chargedTotal
+		parts = append(parts, part)
+	}
+
+	if len(assigned) != len(byID) {
+		return nil, fmt.Errorf("every charged invoice item must be assigned to a part")
+	}
+
+	ratios := make([]float64, len(parts))
+	for i, part := range parts {
+		ratios[i] = part.Ratio
+	}
+	for _, adjustment := range adjustments {
+		shares := allocateVND(adjustment.Amount, ratios)
+		for i := range parts {
+			if shares[i] == 0 {
+				continue
+			}
+			line := adjustment
+			line.ID = 0
+			line.Quantity = 1
+			line.UnitPrice = shares[i]
+			line.Amount = shares[i]
+			parts[i].Items = append(parts[i].Items, line)
+		}
+	}
+
+	return parts, nil
+}
+
+// Chia một khoản tiền theo tỉ lệ, làm tròn đến đồng; phần lẻ dồn vào phần cuối
+// để tổng luôn khớp
+func allocateVND(total float64, ratios []float64) []float64 {
+	shares := make([]float64, len(ratios))
+	var allocated float64
+	for i, ratio := range ratios {
+		if i == len(ratios)-1 {
+			shares[i] = total - allocated
+			break
+		}
+		shares[i] = math.Round(total * ratio)
+		allocated += shares[i]
+	}
+	return shares
+}
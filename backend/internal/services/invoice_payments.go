@@ -0,0 +1,278 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"bi-a-management/internal/models"
+)
+
+// Amounts below this are treated as zero (VND has no minor unit)
+const paymentTolerance = 0.5
+
+// RecordPayment - Thu tiền một hóa đơn bằng một hoặc nhiều hình thức (tiền
+// mặt, chuyển khoản, thẻ, ví điện tử, ví thành viên). Mỗi hình thức trả phần
+// còn lại theo thứ tự; chỉ tiền mặt được đưa dư và phần dư là tiền thối. Hóa
+// đơn chuyển sang paid khi không còn nợ, partially_paid khi mới trả một phần.
+func (s *InvoiceService) RecordPayment(invoiceID int, req *models.PaymentRequest, receivedBy int) (*models.PaymentReceipt, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payments, change, err := s.recordPaymentTx(tx, invoiceID, req.Tenders, receivedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	invoice, err := s.GetInvoiceByID(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PaymentReceipt{Invoice: invoice, Payments: payments, ChangeGiven: change}, nil
+}
+
+// recordPaymentTx - Ghi các khoản thu trong transaction của người gọi; trả về
+// các khoản đã ghi và tiền thối
+func (s *InvoiceService) recordPaymentTx(tx *sql.Tx, invoiceID int, tenders []models.TenderRequest, receivedBy int) ([]models.InvoicePayment, float64, error) {
+	// Khóa hóa đơn để hai quầy không thu cùng lúc
+	var status string
+	var amount, prepaid, paid float64
+	var customerID *uint
+	err := tx.QueryRow(`
+		SELECT COALESCE(payment_status, 'pending'), amount, COALESCE(prepaid_amount, 0), COALESCE(paid_amount, 0), customer_id
+		FROM invoices WHERE id = ? FOR UPDATE
+	`, invoiceID).Scan(&status, &amount, &prepaid, &paid, &customerID)
+	if err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if status != "pending" && status != "partially_paid" {
+		return nil, 0, fmt.Errorf("cannot take payments on a %s invoice", status)
+	}
+
+	remaining := amount - prepaid - paid
+	if remaining < paymentTolerance {
+		return nil, 0, fmt.Errorf("invoice has no balance due")
+	}
+
+	var payments []models.InvoicePayment
+	var totalChange float64
+	for _, tender := range tenders {
+		if remaining < paymentTolerance {
+			return nil, 0, fmt.Errorf("invoice is already covered before the %s tender", tender.Method)
+		}
+
+		applied := math.Min(tender.Amount, remaining)
+		change := tender.Amount - applied
+		if change >= paymentTolerance && tender.Method != "cash" {
+			return nil, 0, fmt.Errorf("%s payment of %.0f exceeds the balance due of %.0f", tender.Method, tender.Amount, remaining)
+		}
+
+		// Trả bằng ví thành viên: trừ số dư ví của khách trên hóa đơn
+		if tender.Method == "wallet" {
+			if customerID == nil {
+				return nil, 0, fmt.Errorf("wallet payments need an invoice linked to a member")
+			}
+			invoiceRef := uint(invoiceID)
+			err := postWalletEntry(tx, &models.WalletTransaction{
+				CustomerID: *customerID,
+				Kind:       WalletPayment,
+				Amount:     -applied,
+				InvoiceID:  &invoiceRef,
+				Reference:  tender.Reference,
+				CreatedBy:  uint(receivedBy),
+			})
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO invoice_payments (invoice_id, method, amount, tendered, change_given, reference, received_by)
+			VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?)
+		`, invoiceID, tender.Method, applied, tender.Amount, change, tender.Reference, receivedBy)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		payments = append(payments, models.InvoicePayment{
+			ID:          uint(id),
+			InvoiceID:   uint(invoiceID),
+			Method:      tender.Method,
+			Amount:      applied,
+			Tendered:    tender.Amount,
+			ChangeGiven: change,
+			Reference:   tender.Reference,
+			ReceivedBy:  uint(receivedBy),
+		})
+
+		paid += applied
+		remaining -= applied
+		totalChange += change
+	}
+
+	if remaining < paymentTolerance {
+		_, err = tx.Exec(
+			"UPDATE invoices SET paid_amount = ?, payment_status = 'paid', paid_at = NOW() WHERE id = ?",
+			paid, invoiceID,
+		)
+		if err == nil {
+			err = s.earnPoints(tx, int64(invoiceID), receivedBy)
+		}
+	} else {
+		_, err = tx.Exec(
+			"UPDATE invoices SET paid_amount = ?, payment_status = 'partially_paid' WHERE id = ?",
+			paid, invoiceID,
+		)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return payments, totalChange, nil
+}
+
+// GetPayments - Các khoản đã thu của một hóa đơn, theo thứ tự thu
+func (s *InvoiceService) GetPayments(invoiceID int) ([]models.InvoicePayment, error) {
+	rows, err := s.db.Query(`
+		SELECT id, invoice_id, method, amount, tendered, change_given, COALESCE(reference, ''),
+		       received_by, created_at
+		FROM invoice_payments
+		WHERE invoice_id = ?
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.InvoicePayment
+	for rows.Next() {
+		var payment models.InvoicePayment
+		err := rows.Scan(
+			&payment.ID, &payment.InvoiceID, &payment.Method, &payment.Amount, &payment.Tendered,
+			&payment.ChangeGiven, &payment.Reference, &payment.ReceivedBy, &payment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, rows.Err()
+}
+
+// getPaymentsByMethod - Tiền thu được theo hình thức thanh toán, lọc theo
+// ngày thu (condition trên p.created_at)
+func (s *InvoiceService) getPaymentsByMethod(condition string, args ...interface{}) (map[string]interface{}, error) {
+	rows, err := s.db.Query(`
+		SELECT p.method, COUNT(*), COALESCE(SUM(p.amount), 0), COALESCE(SUM(p.change_given), 0)
+		FROM invoice_payments p
+		WHERE `+condition+`
+		GROUP BY p.method
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byMethod := make(map[string]interface{})
+	var totalPaid, totalChange float64
+	for rows.Next() {
+		var method string
+		var count int
+		var amount, change float64
+		if err := rows.Scan(&method, &count, &amount, &change); err != nil {
+			return nil, err
+		}
+		byMethod[method] = map[string]interface{}{
+			"payments": count,
+			"amount":   amount,
+		}
+		totalPaid += amount
+		totalChange += change
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"by_method":          byMethod,
+		"total_paid":         totalPaid,
+		"total_change_given": totalChange,
+	}, nil
+}
+
+// getWalletSummary - Biến động ví thành viên trong kỳ (condition trên
+// w.created_at): tiền nạp theo hình thức, tiền thưởng, tiền trả hóa đơn bằng
+// ví và tiền hoàn vào ví; kèm tổng số dư ví hiện còn nợ khách
+func (s *InvoiceService) getWalletSummary(condition string, args ...interface{}) (map[string]interface{}, error) {
+	rows, err := s.db.Query(`
+		SELECT w.kind, COALESCE(w.method, ''), COUNT(*), COALESCE(SUM(w.amount), 0)
+		FROM wallet_transactions w
+		WHERE `+condition+`
+		GROUP BY w.kind, w.method
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	topUpsByMethod := make(map[string]interface{})
+	var topUps, bonus, payments, refunds float64
+	for rows.Next() {
+		var kind, method string
+		var count int
+		var amount float64
+		if err := rows.Scan(&kind, &method, &count, &amount); err != nil {
+			return nil, err
+		}
+		switch kind {
+		case WalletTopUp:
+			topUpsByMethod[method] = map[string]interface{}{
+				"top_ups": count,
+				"amount":  amount,
+			}
+			topUps += amount
+		case WalletBonus:
+			bonus += amount
+		case WalletPayment:
+			payments -= amount
+		case WalletRefund:
+			refunds += amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var liability float64
+	if err := s.db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM wallet_transactions").Scan(&liability); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"top_ups_by_method": topUpsByMethod,
+		"total_top_ups":     topUps,
+		"total_bonus":       bonus,
+		"total_payments":    payments,
+		"total_refunds":     refunds,
+		"wallet_liability":  liability,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/qrcode"
+	"bi-a-management/internal/vietqr"
+)
+
+// Pixels per QR module in the PNG
+const qrImageScale = 8
+
+// GetInvoiceQR - Mã VietQR để khách chuyển khoản số tiền còn nợ của hóa đơn
+// vào tài khoản cấu hình sẵn. Nội dung chuyển khoản là tiền tố + mã hóa đơn
+// (ví dụ HD1024) để đối soát. Mã được tạo tại chỗ, không gọi dịch vụ ngoài.
+func (s *InvoiceService) GetInvoiceQR(invoiceID int) (*models.InvoiceQR, error) {
+	if !s.bank.Configured() {
+		return nil, fmt.Errorf("bank account for VietQR is not configured")
+	}
+
+	invoice, err := s.GetInvoiceByID(invoiceID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if invoice.Status != "pending" && invoice.Status != "partially_paid" {
+		return nil, fmt.Errorf("cannot take payments on a %s invoice", invoice.Status)
+	}
+	if invoice.BalanceDue < paymentTolerance {
+		return nil, fmt.Errorf("invoice has no balance due")
+	}
+
+	transfer := vietqr.Transfer{
+		BankBIN:   s.bank.BankBIN,
+		AccountNo: s.bank.AccountNo,
+		Amount:    int64(math.Round(invoice.BalanceDue)),
+		Reference: fmt.Sprintf("%s%d", s.bank.ReferencePrefix, invoiceID),
+	}
+	payload, err := transfer.Payload()
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := qrcode.Encode([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+	image, err := code.PNG(qrImageScale)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.InvoiceQR{
+		InvoiceID:   invoice.ID,
+		Amount:      float64(transfer.Amount),
+		Reference:   transfer.Reference,
+		BankBIN:     s.bank.BankBIN,
+		AccountNo:   s.bank.AccountNo,
+		AccountName: s.bank.AccountName,
+		Payload:     payload,
+		Image:       image,
+	}, nil
+}
+
+// ConfirmBankTransfer - Ghi nhận khoản chuyển khoản đã về tài khoản cho hóa
+// đơn, kèm mã giao dịch ngân hàng. Mặc định là toàn bộ số tiền còn nợ; một mã
+// giao dịch chỉ được ghi nhận một lần.
+func (s *InvoiceService) ConfirmBankTransfer(invoiceID int, req *models.BankTransferRequest, receivedBy int) (*models.PaymentReceipt, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var amount, prepaid, paid float64
+	err = tx.QueryRow(`
+		SELECT amount, COALESCE(prepaid_amount, 0), COALESCE(paid_amount, 0)
+		FROM invoices WHERE id = ? FOR UPDATE
+	`, invoiceID).Scan(&amount, &prepaid, &paid)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("invoice not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recordedOn int
+	err = tx.QueryRow(`
+		SELECT invoice_id FROM invoice_payments
+		WHERE method = 'bank_transfer' AND reference = ?
+		LIMIT 1
+	`, req.BankReference).Scan(&recordedOn)
+	if err == nil {
+		return nil, fmt.Errorf("bank reference %s was already recorded on invoice %d", req.BankReference, recordedOn)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	tender := models.TenderRequest{
+		Method:    "bank_transfer",
+		Amount:    req.Amount,
+		Reference: req.BankReference,
+	}
+	if tender.Amount == 0 {
+		tender.Amount = math.Max(amount-prepaid-paid, 0)
+	}
+
+	payments, _, err := s.recordPaymentTx(tx, invoiceID, []models.TenderRequest{tender}, receivedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	invoice, err := s.GetInvoiceByID(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PaymentReceipt{Invoice: invoice, Payments: payments}, nil
+}
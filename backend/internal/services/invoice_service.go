@@ -3,17 +3,28 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"bi-a-management/internal/billing"
+	"bi-a-management/internal/loyalty"
 	"bi-a-management/internal/models"
+	"bi-a-management/internal/vietqr"
 )
 
+// Invoices that count towards revenue; a split invoice is represented by its parts
+const revenueInvoiceCondition = "COALESCE(payment_status, 'pending') != 'split'"
+
 type InvoiceService struct {
-	db *sql.DB
+	db     *sql.DB
+	policy billing.Policy
+	bank   vietqr.Account
+	rates  loyalty.Rates
 }
 
-func NewInvoiceService(db *sql.DB) *InvoiceService {
-	return &InvoiceService{db: db}
+func NewInvoiceService(db *sql.DB, policy billing.Policy, bank vietqr.Account, rates loyalty.Rates) *InvoiceService {
+	return &InvoiceService{db: db, policy: policy, bank: bank, rates: rates}
 }
 
 func (s *InvoiceService) CreateInvoice(req *models.CreateInvoiceRequest, createdBy int) (*models.Invoice, error) {
@@ -64,7 +75,9 @@ func (s *InvoiceService) GetInvoiceByID(id int) (*models.Invoice, error) {
 	invoice := &models.Invoice{}
 	query := `
 		SELECT id, amount, table_name, start_time, end_time, play_duration_minutes,
-		       hourly_rate, time_total, services_detail, service_total, discount, created_by, created_at
+		       hourly_rate, time_total, services_detail, service_total, discount, created_by, created_at,
+		       COALESCE(payment_status, 'pending'), session_id, COALESCE(customer_name, ''), customer_id, parent_invoice_id,
+		       COALESCE(prepaid_amount, 0), COALESCE(paid_amount, 0), paid_at, COALESCE(credited_amount, 0)
 		FROM invoices WHERE id = ?
 	`
 
@@ -72,8 +85,26 @@ func (s *InvoiceService) GetInvoiceByID(id int) (*models.Invoice, error) {
 		&invoice.ID, &invoice.Amount, &invoice.TableName, &invoice.StartTime, &invoice.EndTime,
 		&invoice.PlayDurationMinutes, &invoice.HourlyRate, &invoice.TimeTotal, &invoice.ServicesDetail,
 		&invoice.ServiceTotal, &invoice.Discount, &invoice.CreatedBy, &invoice.CreatedAt,
+		&invoice.Status, &invoice.SessionID, &invoice.CustomerName, &invoice.CustomerID, &invoice.ParentInvoiceID,
+		&invoice.PrepaidAmount, &invoice.PaidAmount, &invoice.PaidAt, &invoice.CreditedAmount,
 	)
 
+	if err != nil {
+		return nil, err
+	}
+	settleInvoice(invoice)
+
+	invoice.Items, err = s.getInvoiceItems(id)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.Payments, err = s.GetPayments(id)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.CreditNotes, err = s.GetCreditNotes(id)
 	if err != nil {
 		return nil, err
 	}
@@ -81,10 +112,70 @@ func (s *InvoiceService) GetInvoiceByID(id int) (*models.Invoice, error) {
 	return invoice, nil
 }
 
+// Balance still to collect once the deposit and payments are deducted, or
+// deposit to hand back when it exceeds the total. A voided invoice settles
+// nothing.
+func settleInvoice(invoice *models.Invoice) {
+	if invoice.Status == "cancelled" {
+		invoice.BalanceDue, invoice.ChangeDue = 0, 0
+		return
+	}
+	balance := invoice.Amount - invoice.PrepaidAmount
+	invoice.BalanceDue = math.Max(balance-invoice.PaidAmount, 0)
+	invoice.ChangeDue = math.Max(-balance, 0)
+}
+
+func (s *InvoiceService) getInvoiceItems(invoiceID int) ([]models.InvoiceItem, error) {
+	rows, err := s.db.Query(`
+		SELECT id, invoice_id, item_type, description, start_time, end_time,
+		       minutes, quantity, unit_price, amount
+		FROM invoice_items
+		WHERE invoice_id = ?
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.InvoiceItem
+	for rows.Next() {
+		var item models.InvoiceItem
+		err := rows.Scan(
+			&item.ID, &item.InvoiceID, &item.ItemType, &item.Description, &item.StartTime, &item.EndTime,
+			&item.Minutes, &item.Quantity, &item.UnitPrice, &item.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func insertInvoiceItems(tx *sql.Tx, invoiceID int64, items []models.InvoiceItem) error {
+	for _, item := range items {
+		_, err := tx.Exec(`
+			INSERT INTO invoice_items (
+				invoice_id, item_type, description, start_time, end_time,
+				minutes, quantity, unit_price, amount
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, invoiceID, item.ItemType, item.Description, item.StartTime, item.EndTime,
+			item.Minutes, item.Quantity, item.UnitPrice, item.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *InvoiceService) GetAllInvoices(limit, offset int) ([]*models.Invoice, error) {
 	query := `
 		SELECT id, amount, table_name, start_time, end_time, play_duration_minutes,
-		       hourly_rate, time_total, services_detail, service_total, discount, created_by, created_at
+		       hourly_rate, time_total, services_detail, service_total, discount, created_by, created_at,
+		       COALESCE(payment_status, 'pending'), session_id, COALESCE(customer_name, ''), customer_id, parent_invoice_id,
+		       COALESCE(prepaid_amount, 0), COALESCE(paid_amount, 0), paid_at, COALESCE(credited_amount, 0)
 		FROM invoices 
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
@@ -103,10 +194,13 @@ func (s *InvoiceService) GetAllInvoices(limit, offset int) ([]*models.Invoice, e
 			&invoice.ID, &invoice.Amount, &invoice.TableName, &invoice.StartTime, &invoice.EndTime,
 			&invoice.PlayDurationMinutes, &invoice.HourlyRate, &invoice.TimeTotal, &invoice.ServicesDetail,
 			&invoice.ServiceTotal, &invoice.Discount, &invoice.CreatedBy, &invoice.CreatedAt,
+			&invoice.Status, &invoice.SessionID, &invoice.CustomerName, &invoice.CustomerID, &invoice.ParentInvoiceID,
+			&invoice.PrepaidAmount, &invoice.PaidAmount, &invoice.PaidAt, &invoice.CreditedAmount,
 		)
 		if err != nil {
 			return nil, err
 		}
+		settleInvoice(invoice)
 		invoices = append(invoices, invoice)
 	}
 
@@ -119,28 +213,144 @@ func (s *InvoiceService) GetDailyReport(date string) (map[string]interface{}, er
 			COUNT(*) as total_invoices,
 			SUM(amount) as total_revenue,
 			SUM(time_total) as total_time_revenue,
-			SUM(service_total) as total_service_revenue
+			SUM(service_total) as total_service_revenue,
+			SUM(prepaid_amount) as total_prepaid,
+			SUM(CASE WHEN payment_status = 'cancelled' THEN 0 ELSE GREATEST(amount - prepaid_amount - paid_amount, 0) END) as total_balance_due,
+			SUM(CASE WHEN payment_status = 'cancelled' THEN 0 ELSE GREATEST(prepaid_amount - amount, 0) END) as total_change_due
 		FROM invoices 
-		WHERE DATE(created_at) = ?
+		WHERE DATE(created_at) = ? AND `+revenueInvoiceCondition+`
 	`
 
 	var totalInvoices int
 	var totalRevenue, totalTimeRevenue, totalServiceRevenue sql.NullFloat64
+	var totalPrepaid, totalBalanceDue, totalChangeDue sql.NullFloat64
 
 	err := s.db.QueryRow(query, date).Scan(
 		&totalInvoices, &totalRevenue, &totalTimeRevenue, &totalServiceRevenue,
+		&totalPrepaid, &totalBalanceDue, &totalChangeDue,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	liability, err := s.getDepositLiability(date)
+	if err != nil {
+		return nil, err
+	}
+
+	byTableType, err := s.getRevenueByTableType(date)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := s.getPaymentsByMethod("DATE(p.created_at) = ?", date)
+	if err != nil {
+		return nil, err
+	}
+
+	creditNotes, credited, err := s.getCreditNoteSummary("DATE(cn.created_at) = ?", date)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := s.getWalletSummary("DATE(w.created_at) = ?", date)
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
 		"date":                  date,
 		"total_invoices":        totalInvoices,
-		"total_revenue":         totalRevenue.Float64,
-		"total_time_revenue":    totalTimeRevenue.Float64,
-		"total_service_revenue": totalServiceRevenue.Float64,
+		"gross_revenue":         totalRevenue.Float64,
+		"total_revenue":         totalRevenue.Float64 - credited.Total,
+		"total_time_revenue":    totalTimeRevenue.Float64 - credited.Time,
+		"total_service_revenue": totalServiceRevenue.Float64 - credited.Service,
+		"total_prepaid":         totalPrepaid.Float64,
+		"total_balance_due":     totalBalanceDue.Float64,
+		"total_change_due":      totalChangeDue.Float64,
+		"deposit_liability":     liability,
+		"revenue_by_table_type": byTableType,
+		"payments":              payments,
+		"credit_notes":          creditNotes,
+		"wallets":               wallets,
+	}, nil
+}
+
+// Revenue of a day per type of the table the invoiced session ended on, net
+// of the credit notes issued that day (split between time and service like
+// the invoice they reverse); invoices without a session or whose table has no
+// type come under ""
+func (s *InvoiceService) getRevenueByTableType(date string) ([]map[string]interface{}, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(t.table_type, ''), COALESCE(tt.name, COALESCE(t.table_type, '')),
+		       COALESCE(SUM(x.invoices), 0), COALESCE(SUM(x.revenue), 0), COALESCE(SUM(x.time_total), 0),
+		       COALESCE(SUM(x.service_total), 0)
+		FROM (
+			SELECT session_id, 1 AS invoices, amount AS revenue, time_total, service_total
+			FROM invoices
+			WHERE DATE(created_at) = ? AND COALESCE(payment_status, 'pending') != 'split'
+			UNION ALL
+			SELECT i.session_id, 0, -cn.amount, -`+creditedTimeShare+`, -`+creditedServiceShare+`
+			FROM credit_notes cn
+			JOIN invoices i ON i.id = cn.invoice_id
+			WHERE DATE(cn.created_at) = ?
+		) x
+		LEFT JOIN table_sessions ts ON ts.id = x.session_id
+		LEFT JOIN tables t ON t.id = ts.table_id
+		LEFT JOIN table_types tt ON tt.code = t.table_type
+		GROUP BY COALESCE(t.table_type, ''), COALESCE(tt.name, COALESCE(t.table_type, ''))
+		ORDER BY 4 DESC
+	`, date, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := []map[string]interface{}{}
+	for rows.Next() {
+		var code, name string
+		var invoices int
+		var revenue, timeRevenue, serviceRevenue float64
+		if err := rows.Scan(&code, &name, &invoices, &revenue, &timeRevenue, &serviceRevenue); err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, map[string]interface{}{
+			"table_type":            code,
+			"name":                  name,
+			"total_invoices":        invoices,
+			"total_revenue":         revenue,
+			"total_time_revenue":    timeRevenue,
+			"total_service_revenue": serviceRevenue,
+		})
+	}
+
+	return breakdown, rows.Err()
+}
+
+// Deposits taken on sessions started by the end of date that had not been
+// invoiced by then; the money belongs to the customer until it is consumed
+func (s *InvoiceService) getDepositLiability(date string) (map[string]interface{}, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(ts.prepaid_amount), 0)
+		FROM table_sessions ts
+		WHERE ts.prepaid_amount > 0 AND DATE(ts.start_time) <= ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM invoice_sessions iss
+			JOIN invoices i ON i.id = iss.invoice_id
+			WHERE iss.session_id = ts.id AND DATE(i.created_at) <= ?
+		  )
+	`
+
+	var sessions int
+	var amount float64
+	if err := s.db.QueryRow(query, date, date).Scan(&sessions, &amount); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"sessions": sessions,
+		"amount":   amount,
 	}, nil
 }
 
@@ -150,166 +360,165 @@ func (s *InvoiceService) GetMonthlyReport(year int, month int) (map[string]inter
 			COUNT(*) as total_invoices,
 			SUM(amount) as total_revenue,
 			SUM(time_total) as total_time_revenue,
-			SUM(service_total) as total_service_revenue
+			SUM(service_total) as total_service_revenue,
+			SUM(prepaid_amount) as total_prepaid,
+			SUM(CASE WHEN payment_status = 'cancelled' THEN 0 ELSE GREATEST(amount - prepaid_amount - paid_amount, 0) END) as total_balance_due,
+			SUM(CASE WHEN payment_status = 'cancelled' THEN 0 ELSE GREATEST(prepaid_amount - amount, 0) END) as total_change_due
 		FROM invoices 
-		WHERE YEAR(created_at) = ? AND MONTH(created_at) = ?
+		WHERE YEAR(created_at) = ? AND MONTH(created_at) = ? AND `+revenueInvoiceCondition+`
 	`
 
 	var totalInvoices int
 	var totalRevenue, totalTimeRevenue, totalServiceRevenue sql.NullFloat64
+	var totalPrepaid, totalBalanceDue, totalChangeDue sql.NullFloat64
 
 	err := s.db.QueryRow(query, year, month).Scan(
 		&totalInvoices, &totalRevenue, &totalTimeRevenue, &totalServiceRevenue,
+		&totalPrepaid, &totalBalanceDue, &totalChangeDue,
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	payments, err := s.getPaymentsByMethod("YEAR(p.created_at) = ? AND MONTH(p.created_at) = ?", year, month)
+	if err != nil {
+		return nil, err
+	}
+
+	creditNotes, credited, err := s.getCreditNoteSummary("YEAR(cn.created_at) = ? AND MONTH(cn.created_at) = ?", year, month)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := s.getWalletSummary("YEAR(w.created_at) = ? AND MONTH(w.created_at) = ?", year, month)
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
 		"year":                  year,
 		"month":                 month,
 		"total_invoices":        totalInvoices,
-		"total_revenue":         totalRevenue.Float64,
-		"total_time_revenue":    totalTimeRevenue.Float64,
-		"total_service_revenue": totalServiceRevenue.Float64,
+		"gross_revenue":         totalRevenue.Float64,
+		"total_revenue":         totalRevenue.Float64 - credited.Total,
+		"total_time_revenue":    totalTimeRevenue.Float64 - credited.Time,
+		"total_service_revenue": totalServiceRevenue.Float64 - credited.Service,
+		"total_prepaid":         totalPrepaid.Float64,
+		"total_balance_due":     totalBalanceDue.Float64,
+		"total_change_due":      totalChangeDue.Float64,
+		"payments":              payments,
+		"credit_notes":          creditNotes,
+		"wallets":               wallets,
 	}, nil
 }
 
-// CreateInvoiceFromSession - Tự động tạo hóa đơn từ session khi kết thúc
-func (s *InvoiceService) CreateInvoiceFromSession(sessionID int, createdBy int) (*models.Invoice, error) {
-	// 1. Lấy thông tin session
-	sessionQuery := `
-		SELECT ts.id, ts.table_id, ts.customer_name, ts.start_time, ts.preset_duration_minutes, 
-		       ts.remaining_minutes, ts.actual_duration_minutes, ts.hourly_rate, ts.prepaid_amount,
-		       ts.session_type, t.name as table_name
-		FROM table_sessions ts
-		JOIN tables t ON ts.table_id = t.id 
-		WHERE ts.id = ?
-	`
-	
-	var session struct {
-		ID                   int            `db:"id"`
-		TableID              int            `db:"table_id"`
-		CustomerName         sql.NullString `db:"customer_name"`
-		StartTime            time.Time      `db:"start_time"`
-		PresetDurationMinutes sql.NullInt64 `db:"preset_duration_minutes"`
-		RemainingMinutes     sql.NullInt64  `db:"remaining_minutes"`
-		ActualDurationMinutes sql.NullInt64 `db:"actual_duration_minutes"`
-		HourlyRate           float64        `db:"hourly_rate"`
-		PrepaidAmount        float64        `db:"prepaid_amount"`
-		SessionType          string         `db:"session_type"`
-		TableName            string         `db:"table_name"`
-	}
-
-	err := s.db.QueryRow(sessionQuery, sessionID).Scan(
-		&session.ID, &session.TableID, &session.CustomerName, &session.StartTime,
-		&session.PresetDurationMinutes, &session.RemainingMinutes, &session.ActualDurationMinutes,
-		&session.HourlyRate, &session.PrepaidAmount, &session.SessionType, &session.TableName,
-	)
+// CreateInvoiceFromSessionTx - Tạo hóa đơn cho session khi kết thúc, trong
+// transaction kết thúc session; trả về ID hóa đơn, chỉ đọc được sau khi commit
+func (s *InvoiceService) CreateInvoiceFromSessionTx(tx *sql.Tx, sessionID int, createdBy int) (int64, error) {
+	invoiced, err := isSessionInvoiced(tx, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session: %v", err)
+		return 0, err
 	}
-
-	// 2. Tính toán thời gian chơi thực tế
-	endTime := time.Now()
-	var actualDurationMinutes int
-	var tableAmount float64
-
-	if session.SessionType == "fixed_time" {
-		// Chơi theo giờ cố định: tính theo preset_duration
-		if session.PresetDurationMinutes.Valid {
-			actualDurationMinutes = int(session.PresetDurationMinutes.Int64)
-		}
-		tableAmount = (float64(actualDurationMinutes) / 60.0) * session.HourlyRate
-	} else {
-		// Chơi mở: tính theo thời gian thực tế
-		if session.ActualDurationMinutes.Valid {
-			actualDurationMinutes = int(session.ActualDurationMinutes.Int64)
-		} else {
-			// Tính từ start_time đến hiện tại
-			duration := endTime.Sub(session.StartTime)
-			actualDurationMinutes = int(duration.Minutes())
-		}
-		tableAmount = (float64(actualDurationMinutes) / 60.0) * session.HourlyRate
+	if invoiced {
+		return 0, &SessionStateError{SessionID: sessionID, Status: SessionInvoiced, Action: "invoice"}
 	}
 
-	// 3. Lấy tổng tiền orders trong session
-	ordersQuery := `
-		SELECT COALESCE(SUM(total_price), 0) as orders_total
-		FROM session_orders 
-		WHERE session_id = ? AND status != 'cancelled'
-	`
-	var ordersAmount float64
-	err = s.db.QueryRow(ordersQuery, sessionID).Scan(&ordersAmount)
+	quote, err := s.quoteSession(tx, sessionID, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate orders amount: %v", err)
+		return 0, err
 	}
 
-	// 4. Tính tổng tiền
-	totalAmount := tableAmount + ordersAmount
+	return s.createInvoiceFromQuote(tx, quote, createdBy)
+}
 
-	// 5. Lấy chi tiết orders để lưu vào services_detail
-	ordersDetailQuery := `
-		SELECT p.name, so.quantity, so.unit_price, so.total_price, so.note
-		FROM session_orders so
-		JOIN products p ON so.product_id = p.id
-		WHERE so.session_id = ? AND so.status != 'cancelled'
-		ORDER BY so.ordered_at
-	`
-	
-	rows, err := s.db.Query(ordersDetailQuery, sessionID)
+// QuoteSession - Tính tiền một session (giờ chơi theo từng bàn, orders, làm tròn)
+func (s *InvoiceService) QuoteSession(sessionID int, endTime time.Time) (*billing.Quote, error) {
+	return s.quoteSession(s.db, sessionID, endTime)
+}
+
+func (s *InvoiceService) quoteSession(q sessionQueryer, sessionID int, endTime time.Time) (*billing.Quote, error) {
+	session, err := loadSession(q, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get orders detail: %v", err)
+		return nil, fmt.Errorf("failed to get session: %v", err)
 	}
-	defer rows.Close()
 
+	quote, err := quoteSession(q, s.policy, session, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate session amount: %v", err)
+	}
+
+	return quote, nil
+}
+
+// createInvoiceFromQuote - Lưu hóa đơn và các dòng chi tiết của một báo giá
+// trong transaction của người gọi
+func (s *InvoiceService) createInvoiceFromQuote(tx *sql.Tx, quote *billing.Quote, createdBy int) (int64, error) {
+	// Chi tiết orders dạng text cho máy in nhiệt
 	var servicesDetail string
-	for rows.Next() {
-		var name string
-		var quantity int
-		var unitPrice, totalPrice float64
-		var note sql.NullString
-		
-		err := rows.Scan(&name, &quantity, &unitPrice, &totalPrice, &note)
-		if err != nil {
-			continue
-		}
-		
-		noteText := ""
-		if note.Valid && note.String != "" {
-			noteText = fmt.Sprintf(" (%s)", note.String)
+	for _, line := range quote.Lines {
+		if line.ItemType == "order" {
+			noteText := ""
+			if line.Note != "" {
+				noteText = fmt.Sprintf(" (%s)", line.Note)
+			}
+			servicesDetail += fmt.Sprintf("- %s x%d: %.0f VNĐ%s\n", line.Description, line.Quantity, line.Amount, noteText)
 		}
-		
-		servicesDetail += fmt.Sprintf("- %s x%d: %.0f VNĐ%s\n", name, quantity, totalPrice, noteText)
 	}
 
-	// 6. Tạo hóa đơn
 	insertQuery := `
 		INSERT INTO invoices (
 			amount, table_amount, orders_amount, discount_amount,
 			table_name, start_time, end_time, play_duration_minutes,
 			hourly_rate, time_total, services_detail, service_total, 
-			discount, session_id, customer_name, payment_status, created_by
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?)
+			discount, session_id, customer_name, customer_id, prepaid_amount, payment_status, paid_at, created_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := s.db.Exec(insertQuery,
-		totalAmount, tableAmount, ordersAmount, 0, // discount_amount = 0 for now
-		session.TableName, session.StartTime, endTime, actualDurationMinutes,
-		session.HourlyRate, tableAmount, servicesDetail, ordersAmount,
-		0, sessionID, session.CustomerName.String, createdBy,
+	// Hóa đơn đã được tiền cọc trả hết thì không cần thu thêm
+	status := "pending"
+	var paidAt interface{}
+	if quote.BalanceDue < paymentTolerance {
+		status = "paid"
+		paidAt = time.Now()
+	}
+
+	result, err := tx.Exec(insertQuery,
+		quote.Total, quote.TableAmount, quote.OrdersAmount, quote.Discount,
+		strings.Join(quote.TableNames, " → "), quote.StartTime, quote.EndTime, quote.Minutes,
+		quote.HourlyRate, quote.TableAmount, servicesDetail, quote.OrdersAmount,
+		quote.Discount, quote.SessionIDs[0], quote.CustomerName, quote.CustomerID, quote.PrepaidAmount, status, paidAt, createdBy,
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create invoice: %v", err)
+		return 0, fmt.Errorf("failed to create invoice: %v", err)
 	}
 
 	invoiceID, err := result.LastInsertId()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get invoice ID: %v", err)
+		return 0, fmt.Errorf("failed to get invoice ID: %v", err)
+	}
+
+	if err := insertInvoiceItems(tx, invoiceID, quote.Lines); err != nil {
+		return 0, fmt.Errorf("failed to create invoice items: %v", err)
+	}
+
+	if err := recordInvoiceDiscounts(tx, invoiceID, quote.Discounts); err != nil {
+		return 0, fmt.Errorf("failed to record discounts: %v", err)
+	}
+
+	for _, sessionID := range quote.SessionIDs {
+		_, err := tx.Exec("INSERT INTO invoice_sessions (invoice_id, session_id) VALUES (?, ?)", invoiceID, sessionID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to link session %d: %v", sessionID, err)
+		}
+	}
+
+	if status == "paid" {
+		if err := s.earnPoints(tx, invoiceID, createdBy); err != nil {
+			return 0, fmt.Errorf("failed to earn points: %v", err)
+		}
 	}
 
-	// 7. Lấy hóa đơn vừa tạo để trả về
-	return s.GetInvoiceByID(int(invoiceID))
+	return invoiceID, nil
 }
@@ -0,0 +1,513 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"bi-a-management/internal/loyalty"
+	"bi-a-management/internal/models"
+)
+
+// Kinds of loyalty points ledger entries
+const (
+	PointsEarn     = "earn"
+	PointsRedeem   = "redeem"
+	PointsExpire   = "expire"
+	PointsReversal = "reversal"
+)
+
+type LoyaltyService struct {
+	db    *sql.DB
+	rates loyalty.Rates
+}
+
+func NewLoyaltyService(db *sql.DB, rates loyalty.Rates) *LoyaltyService {
+	return &LoyaltyService{db: db, rates: rates}
+}
+
+// Rates the points programme runs on
+func (s *LoyaltyService) GetRates() loyalty.Rates {
+	return s.rates
+}
+
+// GetPoints expires whatever is due, then recomputes a member's points
+// balance and totals from the ledger and returns a page of it newest first
+func (s *LoyaltyService) GetPoints(customerID int, limit int, offset int) (*models.PointsAccount, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockPointsAccount(tx, uint(customerID)); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	account := &models.PointsAccount{CustomerID: uint(customerID), Entries: []models.PointsEntry{}}
+
+	rows, err := s.db.Query(`
+		SELECT kind, points, expires_at
+		FROM loyalty_points
+		WHERE customer_id = ?
+		ORDER BY id
+	`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []loyalty.Lot
+	var spent int
+	for rows.Next() {
+		var kind string
+		var points int
+		var expiresAt *time.Time
+		if err := rows.Scan(&kind, &points, &expiresAt); err != nil {
+			return nil, err
+		}
+
+		account.Balance += points
+		switch kind {
+		case PointsEarn:
+			account.TotalEarned += points
+			lots = append(lots, loyalty.Lot{Points: points, ExpiresAt: expiresAt})
+			continue
+		case PointsRedeem:
+			account.TotalRedeemed -= points
+		case PointsExpire:
+			account.TotalExpired -= points
+		case PointsReversal:
+			account.TotalReversed -= points
+		}
+		spent -= points
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	account.ExpiringPoints, account.NextExpiry = loyalty.NextExpiry(lots, spent, time.Now())
+
+	entries, err := s.db.Query(`
+		SELECT id, customer_id, kind, points, balance_after, invoice_id, session_id, expires_at,
+		       COALESCE(note, ''), created_by, created_at
+		FROM loyalty_points
+		WHERE customer_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, customerID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer entries.Close()
+
+	for entries.Next() {
+		var entry models.PointsEntry
+		err := entries.Scan(
+			&entry.ID, &entry.CustomerID, &entry.Kind, &entry.Points, &entry.BalanceAfter, &entry.InvoiceID,
+			&entry.SessionID, &entry.ExpiresAt, &entry.Note, &entry.CreatedBy, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		account.Entries = append(account.Entries, entry)
+	}
+
+	return account, entries.Err()
+}
+
+// RedeemPoints spends a member's points on their live session, for free
+// minutes at the session's hourly rate or to pay for one of its orders. The
+// points leave the balance straight away; the session's bill takes the value
+// off when it is priced.
+func (s *LoyaltyService) RedeemPoints(sessionID int, req *models.RedeemPointsRequest, createdBy int) (*models.PointRedemption, error) {
+	if (req.Minutes > 0) == (req.OrderID != 0) {
+		return nil, fmt.Errorf("give either minutes or order_id")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockLiveSession(tx, sessionID, "redeem points on"); err != nil {
+		return nil, err
+	}
+
+	var customerID *uint
+	var hourlyRate float64
+	err = tx.QueryRow("SELECT customer_id, hourly_rate FROM table_sessions WHERE id = ?", sessionID).Scan(&customerID, &hourlyRate)
+	if err != nil {
+		return nil, err
+	}
+	if customerID == nil {
+		return nil, fmt.Errorf("only a member's session can redeem points")
+	}
+
+	redemption := models.PointRedemption{
+		SessionID:  uint(sessionID),
+		CustomerID: *customerID,
+		Minutes:    req.Minutes,
+		CreatedBy:  uint(createdBy),
+	}
+
+	if req.Minutes > 0 {
+		redemption.Points, err = s.rates.MinutesCost(req.Minutes)
+		if err != nil {
+			return nil, err
+		}
+		redemption.Value = math.Round(float64(req.Minutes) * hourlyRate / 60)
+		redemption.Description = fmt.Sprintf("%d phút miễn phí", req.Minutes)
+	} else {
+		var name, status string
+		var quantity int
+		var total float64
+		err := tx.QueryRow(`
+			SELECT p.name, o.quantity, o.total_price, o.status
+			FROM session_orders o
+			JOIN products p ON p.id = o.product_id
+			WHERE o.id = ? AND o.session_id = ?
+		`, req.OrderID, sessionID).Scan(&name, &quantity, &total, &status)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("order not found on this session")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status == "cancelled" {
+			return nil, fmt.Errorf("order is cancelled")
+		}
+
+		var redeemed bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM session_point_redemptions WHERE order_id = ?)", req.OrderID).Scan(&redeemed)
+		if err != nil {
+			return nil, err
+		}
+		if redeemed {
+			return nil, fmt.Errorf("order is already paid with points")
+		}
+
+		redemption.Points, err = s.rates.OrderCost(total)
+		if err != nil {
+			return nil, err
+		}
+		orderID := req.OrderID
+		redemption.OrderID = &orderID
+		redemption.Value = total
+		redemption.Description = fmt.Sprintf("%s x%d", name, quantity)
+	}
+
+	sessionRef := uint(sessionID)
+	err = postPointsEntry(tx, &models.PointsEntry{
+		CustomerID: *customerID,
+		Kind:       PointsRedeem,
+		Points:     -redemption.Points,
+		SessionID:  &sessionRef,
+		Note:       redemption.Description,
+		CreatedBy:  uint(createdBy),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO session_point_redemptions
+		(session_id, customer_id, minutes, order_id, description, points, value, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, redemption.SessionID, redemption.CustomerID, redemption.Minutes, redemption.OrderID,
+		redemption.Description, redemption.Points, redemption.Value, redemption.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	redemption.ID = uint(id)
+	redemption.CreatedAt = time.Now()
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &redemption, nil
+}
+
+// CancelRedemption takes a redemption back off a live session and gives the
+// member their points back
+func (s *LoyaltyService) CancelRedemption(sessionID int, redemptionID int, cancelledBy int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockLiveSession(tx, sessionID, "cancel a redemption on"); err != nil {
+		return err
+	}
+
+	var found bool
+	err = tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM session_point_redemptions WHERE id = ? AND session_id = ?)",
+		redemptionID, sessionID,
+	).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("redemption not found")
+	}
+
+	if err := releaseRedemption(tx, redemptionID, cancelledBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete a redemption and give its points back, in the caller's transaction
+func releaseRedemption(tx *sql.Tx, redemptionID int, releasedBy int) error {
+	var sessionID, customerID uint
+	var points int
+	var description string
+	err := tx.QueryRow(`
+		SELECT session_id, customer_id, points, description FROM session_point_redemptions WHERE id = ?
+	`, redemptionID).Scan(&sessionID, &customerID, &points, &description)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM session_point_redemptions WHERE id = ?", redemptionID); err != nil {
+		return err
+	}
+
+	return postPointsEntry(tx, &models.PointsEntry{
+		CustomerID: customerID,
+		Kind:       PointsReversal,
+		Points:     points,
+		SessionID:  &sessionID,
+		Note:       "Hủy đổi điểm: " + description,
+		CreatedBy:  uint(releasedBy),
+	})
+}
+
+// Give back the points an order was paid with, if it was
+func releaseOrderRedemption(tx *sql.Tx, orderID int, releasedBy int) error {
+	var redemptionID int
+	err := tx.QueryRow("SELECT id FROM session_point_redemptions WHERE order_id = ?", orderID).Scan(&redemptionID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return releaseRedemption(tx, redemptionID, releasedBy)
+}
+
+// Points redemptions of a session, in the order they were made
+func loadSessionRedemptions(q sessionQueryer, sessionID int) ([]models.PointRedemption, error) {
+	rows, err := q.Query(`
+		SELECT id, session_id, customer_id, minutes, order_id, description, points, value, created_by, created_at
+		FROM session_point_redemptions
+		WHERE session_id = ?
+		ORDER BY id
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var redemptions []models.PointRedemption
+	for rows.Next() {
+		var redemption models.PointRedemption
+		err := rows.Scan(
+			&redemption.ID, &redemption.SessionID, &redemption.CustomerID, &redemption.Minutes, &redemption.OrderID,
+			&redemption.Description, &redemption.Points, &redemption.Value, &redemption.CreatedBy, &redemption.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, redemption)
+	}
+
+	return redemptions, rows.Err()
+}
+
+// earnPoints - Cộng điểm cho thành viên khi hóa đơn đã thu đủ, theo số tiền
+// hóa đơn sau credit note. Mỗi hóa đơn chỉ được cộng một lần.
+func (s *InvoiceService) earnPoints(tx *sql.Tx, invoiceID int64, createdBy int) error {
+	var customerID *uint
+	var amount, credited float64
+	err := tx.QueryRow(
+		"SELECT customer_id, amount, COALESCE(credited_amount, 0) FROM invoices WHERE id = ?",
+		invoiceID,
+	).Scan(&customerID, &amount, &credited)
+	if err != nil || customerID == nil {
+		return err
+	}
+
+	points := s.rates.Earned(amount - credited)
+	if points == 0 {
+		return nil
+	}
+
+	var earned bool
+	err = tx.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM loyalty_points WHERE invoice_id = ? AND kind = ?)",
+		invoiceID, PointsEarn,
+	).Scan(&earned)
+	if err != nil || earned {
+		return err
+	}
+
+	invoiceRef := uint(invoiceID)
+	return postPointsEntry(tx, &models.PointsEntry{
+		CustomerID: *customerID,
+		Kind:       PointsEarn,
+		Points:     points,
+		InvoiceID:  &invoiceRef,
+		ExpiresAt:  s.rates.ExpiresAt(time.Now()),
+		Note:       fmt.Sprintf("Hóa đơn #%d", invoiceID),
+		CreatedBy:  uint(createdBy),
+	})
+}
+
+// reverseInvoicePoints - Khi hủy hóa đơn: thu hồi điểm đã cộng cho hóa đơn
+// (trong phạm vi số dư còn lại) và trả lại điểm đã đổi trên các session của nó
+func reverseInvoicePoints(tx *sql.Tx, invoiceID int, customerID *uint, reversedBy int) error {
+	if customerID == nil {
+		return nil
+	}
+	invoiceRef := uint(invoiceID)
+
+	var earned int
+	err := tx.QueryRow("SELECT COALESCE(SUM(points), 0) FROM loyalty_points WHERE invoice_id = ?", invoiceID).Scan(&earned)
+	if err != nil {
+		return err
+	}
+
+	if earned > 0 {
+		balance, err := lockPointsAccount(tx, *customerID)
+		if err != nil {
+			return err
+		}
+		// Points already spent or expired cannot be taken back
+		if take := min(earned, max(balance, 0)); take > 0 {
+			err := postPointsEntry(tx, &models.PointsEntry{
+				CustomerID: *customerID,
+				Kind:       PointsReversal,
+				Points:     -take,
+				InvoiceID:  &invoiceRef,
+				Note:       fmt.Sprintf("Hủy hóa đơn #%d", invoiceID),
+				CreatedBy:  uint(reversedBy),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var redeemed int
+	err = tx.QueryRow(`
+		SELECT COALESCE(-SUM(points), 0) FROM loyalty_points
+		WHERE customer_id = ? AND session_id IN (SELECT session_id FROM invoice_sessions WHERE invoice_id = ?)
+	`, *customerID, invoiceID).Scan(&redeemed)
+	if err != nil {
+		return err
+	}
+
+	if redeemed > 0 {
+		return postPointsEntry(tx, &models.PointsEntry{
+			CustomerID: *customerID,
+			Kind:       PointsReversal,
+			Points:     redeemed,
+			InvoiceID:  &invoiceRef,
+			Note:       fmt.Sprintf("Trả lại điểm đã đổi, hủy hóa đơn #%d", invoiceID),
+			CreatedBy:  uint(reversedBy),
+		})
+	}
+	return nil
+}
+
+// postPointsEntry appends an entry to a member's points ledger in the
+// caller's transaction, after expiring whatever is due, and refuses an entry
+// that would take the balance below zero
+func postPointsEntry(tx *sql.Tx, entry *models.PointsEntry) error {
+	balance, err := lockPointsAccount(tx, entry.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	if balance+entry.Points < 0 {
+		return fmt.Errorf("not enough points: %d available, %d needed", balance, -entry.Points)
+	}
+
+	return insertPointsEntry(tx, entry, balance)
+}
+
+// Lock a member's points for the rest of the transaction, expire the points
+// whose time has come and return the balance left
+func lockPointsAccount(tx *sql.Tx, customerID uint) (int, error) {
+	var id uint
+	err := tx.QueryRow("SELECT id FROM customers WHERE id = ? FOR UPDATE", customerID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("customer not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var balance, expiredEarned, spent int
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(points), 0),
+		       COALESCE(SUM(CASE WHEN kind = ? AND expires_at <= NOW() THEN points ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN kind != ? THEN -points ELSE 0 END), 0)
+		FROM loyalty_points WHERE customer_id = ?
+	`, PointsEarn, PointsEarn, customerID).Scan(&balance, &expiredEarned, &spent)
+	if err != nil {
+		return 0, err
+	}
+
+	expiring := loyalty.Expiring(expiredEarned, spent)
+	if expiring == 0 {
+		return balance, nil
+	}
+
+	// Entries the system makes on its own have no user
+	err = insertPointsEntry(tx, &models.PointsEntry{
+		CustomerID: customerID,
+		Kind:       PointsExpire,
+		Points:     -expiring,
+		Note:       "Điểm hết hạn",
+	}, balance)
+	if err != nil {
+		return 0, err
+	}
+	return balance - expiring, nil
+}
+
+func insertPointsEntry(tx *sql.Tx, entry *models.PointsEntry, balance int) error {
+	entry.BalanceAfter = balance + entry.Points
+	result, err := tx.Exec(`
+		INSERT INTO loyalty_points
+		(customer_id, kind, points, balance_after, invoice_id, session_id, expires_at, note, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?)
+	`, entry.CustomerID, entry.Kind, entry.Points, entry.BalanceAfter, entry.InvoiceID, entry.SessionID,
+		entry.ExpiresAt, entry.Note, entry.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = uint(id)
+	return nil
+}
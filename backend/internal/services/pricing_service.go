@@ -0,0 +1,274 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"bi-a-management/internal/billing"
+	"bi-a-management/internal/models"
+)
+
+type PricingService struct {
+	db *sql.DB
+}
+
+func NewPricingService(db *sql.DB) *PricingService {
+	return &PricingService{db: db}
+}
+
+// Get all pricing rules
+func (s *PricingService) GetAllRules() ([]models.PricingRule, error) {
+	return loadPricingRules(s.db, false)
+}
+
+// Get pricing rule by ID
+func (s *PricingService) GetRuleByID(id int) (*models.PricingRule, error) {
+	rules, err := loadPricingRules(s.db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		if rules[i].ID == uint(id) {
+			return &rules[i], nil
+		}
+	}
+	return nil, fmt.Errorf("pricing rule not found")
+}
+
+// Create pricing rule
+func (s *PricingService) CreateRule(req *models.PricingRuleRequest) (*models.PricingRule, error) {
+	if err := validatePricingRule(s.db, req); err != nil {
+		return nil, err
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO pricing_rules (name, table_type, zone, weekdays, start_time, end_time, hourly_rate, priority, is_active)
+		VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+	`, req.Name, req.TableType, req.Zone, formatWeekdays(req.Weekdays), req.StartTime, req.EndTime, req.HourlyRate, req.Priority, isActive)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := replacePricingRuleTables(tx, id, req.TableIDs); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetRuleByID(int(id))
+}
+
+// Update pricing rule
+func (s *PricingService) UpdateRule(id int, req *models.PricingRuleRequest) (*models.PricingRule, error) {
+	if err := validatePricingRule(s.db, req); err != nil {
+		return nil, err
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE pricing_rules
+		SET name = ?, table_type = NULLIF(?, ''), zone = NULLIF(?, ''), weekdays = ?, start_time = ?, end_time = ?,
+		    hourly_rate = ?, priority = ?, is_active = ?
+		WHERE id = ?
+	`, req.Name, req.TableType, req.Zone, formatWeekdays(req.Weekdays), req.StartTime, req.EndTime, req.HourlyRate, req.Priority, isActive, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM pricing_rules WHERE id = ?)", id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("pricing rule not found")
+		}
+	}
+
+	if err := replacePricingRuleTables(tx, int64(id), req.TableIDs); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.GetRuleByID(id)
+}
+
+// Delete pricing rule. Invoices keep their own copy of the rates they used.
+func (s *PricingService) DeleteRule(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM pricing_rules WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("pricing rule not found")
+	}
+
+	if _, err := tx.Exec("DELETE FROM pricing_rule_tables WHERE rule_id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replacePricingRuleTables(tx *sql.Tx, ruleID int64, tableIDs []uint) error {
+	if _, err := tx.Exec("DELETE FROM pricing_rule_tables WHERE rule_id = ?", ruleID); err != nil {
+		return err
+	}
+
+	for _, tableID := range tableIDs {
+		_, err := tx.Exec("INSERT IGNORE INTO pricing_rule_tables (rule_id, table_id) VALUES (?, ?)", ruleID, tableID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePricingRule(q sessionQueryer, req *models.PricingRuleRequest) error {
+	start, err := billing.ParseClock(req.StartTime)
+	if err != nil {
+		return fmt.Errorf("invalid start_time, expected HH:MM")
+	}
+
+	end, err := billing.ParseClock(req.EndTime)
+	if err != nil {
+		return fmt.Errorf("invalid end_time, expected HH:MM")
+	}
+
+	if start == end {
+		return fmt.Errorf("start_time and end_time must differ")
+	}
+
+	req.TableType = strings.TrimSpace(req.TableType)
+	req.Zone = strings.TrimSpace(req.Zone)
+	if _, err := defaultHourlyRate(q, req.TableType); err != nil {
+		return err
+	}
+	return checkZone(q, req.Zone)
+}
+
+// Load pricing rules with their table group, optionally only active ones
+func loadPricingRules(q sessionQueryer, activeOnly bool) ([]models.PricingRule, error) {
+	query := `
+		SELECT id, name, COALESCE(table_type, ''), COALESCE(zone, ''), weekdays, start_time, end_time,
+		       hourly_rate, priority, is_active, created_at, updated_at
+		FROM pricing_rules
+	`
+	if activeOnly {
+		query += " WHERE is_active = true"
+	}
+	query += " ORDER BY priority DESC, id"
+
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.PricingRule
+	index := make(map[uint]int)
+	for rows.Next() {
+		var rule models.PricingRule
+		var weekdays, startTime, endTime string
+		err := rows.Scan(
+			&rule.ID, &rule.Name, &rule.TableType, &rule.Zone, &weekdays, &startTime, &endTime, &rule.HourlyRate,
+			&rule.Priority, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rule.Weekdays = parseWeekdays(weekdays)
+		rule.StartTime = trimClock(startTime)
+		rule.EndTime = trimClock(endTime)
+		rule.TableIDs = []uint{}
+		index[rule.ID] = len(rules)
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tableRows, err := q.Query("SELECT rule_id, table_id FROM pricing_rule_tables ORDER BY rule_id, table_id")
+	if err != nil {
+		return nil, err
+	}
+	defer tableRows.Close()
+
+	for tableRows.Next() {
+		var ruleID, tableID uint
+		if err := tableRows.Scan(&ruleID, &tableID); err != nil {
+			return nil, err
+		}
+		if i, ok := index[ruleID]; ok {
+			rules[i].TableIDs = append(rules[i].TableIDs, tableID)
+		}
+	}
+
+	return rules, tableRows.Err()
+}
+
+func trimClock(value string) string {
+	if len(value) > 5 {
+		return value[:5]
+	}
+	return value
+}
+
+func formatWeekdays(weekdays []int) string {
+	parts := make([]string, len(weekdays))
+	for i, weekday := range weekdays {
+		parts[i] = strconv.Itoa(weekday)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseWeekdays(value string) []int {
+	weekdays := []int{}
+	for _, part := range strings.Split(value, ",") {
+		if weekday, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			weekdays = append(weekdays, weekday)
+		}
+	}
+	return weekdays
+}
@@ -5,20 +5,39 @@ import (
 	"fmt"
 
 	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
 )
 
 type ProductService struct {
-	db *sql.DB
+	db  *sql.DB
+	hub *realtime.Hub
 }
 
-func NewProductService(db *sql.DB) *ProductService {
-	return &ProductService{db: db}
+func NewProductService(db *sql.DB, hub *realtime.Hub) *ProductService {
+	return &ProductService{db: db, hub: hub}
+}
+
+const productColumns = `
+	id, name, category, price, description, is_active, track_stock, stock, min_stock, created_at, updated_at
+`
+
+func scanProduct(row rowScanner) (*models.Product, error) {
+	var product models.Product
+	err := row.Scan(
+		&product.ID, &product.Name, &product.Category, &product.Price,
+		&product.Description, &product.IsActive, &product.TrackStock, &product.Stock, &product.MinStock,
+		&product.CreatedAt, &product.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
 }
 
 // Get all products
 func (s *ProductService) GetAllProducts() ([]models.Product, error) {
 	query := `
-		SELECT id, name, category, price, description, is_active, created_at, updated_at 
+		SELECT ` + productColumns + `
 		FROM products 
 		WHERE is_active = true
 		ORDER BY category, name
@@ -32,16 +51,11 @@ func (s *ProductService) GetAllProducts() ([]models.Product, error) {
 
 	var products []models.Product
 	for rows.Next() {
-		var product models.Product
-		err := rows.Scan(
-			&product.ID, &product.Name, &product.Category, &product.Price,
-			&product.Description, &product.IsActive,
-			&product.CreatedAt, &product.UpdatedAt,
-		)
+		product, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
-		products = append(products, product)
+		products = append(products, *product)
 	}
 
 	return products, nil
@@ -50,7 +64,7 @@ func (s *ProductService) GetAllProducts() ([]models.Product, error) {
 // Get products by category
 func (s *ProductService) GetProductsByCategory(category string) ([]models.Product, error) {
 	query := `
-		SELECT id, name, category, price, description, is_active, created_at, updated_at 
+		SELECT ` + productColumns + `
 		FROM products 
 		WHERE category = ? AND is_active = true
 		ORDER BY name
@@ -64,34 +78,19 @@ func (s *ProductService) GetProductsByCategory(category string) ([]models.Produc
 
 	var products []models.Product
 	for rows.Next() {
-		var product models.Product
-		err := rows.Scan(
-			&product.ID, &product.Name, &product.Category, &product.Price,
-			&product.Description, &product.IsActive,
-			&product.CreatedAt, &product.UpdatedAt,
-		)
+		product, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
-		products = append(products, product)
+		products = append(products, *product)
 	}
 
 	return products, nil
 }
 
-// Add order to session
-func (s *ProductService) AddOrderToSession(req *models.AddOrderRequest) ([]models.SessionOrder, error) {
-	// Verify session exists and is active
-	var sessionStatus string
-	err := s.db.QueryRow("SELECT status FROM table_sessions WHERE id = ?", req.SessionID).Scan(&sessionStatus)
-	if err != nil {
-		return nil, fmt.Errorf("session not found")
-	}
-	
-	if sessionStatus != "active" {
-		return nil, fmt.Errorf("session is not active")
-	}
-
+// Add order to session. Tracked products come out of stock, and an order for
+// more than is left is refused.
+func (s *ProductService) AddOrderToSession(req *models.AddOrderRequest, createdBy int) ([]models.SessionOrder, error) {
 	// Start transaction
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -99,20 +98,35 @@ func (s *ProductService) AddOrderToSession(req *models.AddOrderRequest) ([]model
 	}
 	defer tx.Rollback()
 
+	// Verify session exists and is still on its table; paused customers can
+	// still order at the bar. The lock keeps the session from being ended
+	// and billed while the order goes in.
+	if _, err := lockLiveSession(tx, int(req.SessionID), "add orders to"); err != nil {
+		return nil, err
+	}
+
 	var orders []models.SessionOrder
+	var lowStock []*stockLevel
 
 	for _, item := range req.Items {
 		// Get product details
 		var product models.Product
 		err := tx.QueryRow(
-			"SELECT id, name, price FROM products WHERE id = ? AND is_active = true",
+			"SELECT id, name, price, track_stock, stock FROM products WHERE id = ? AND is_active = true FOR UPDATE",
 			item.ProductID,
-		).Scan(&product.ID, &product.Name, &product.Price)
+		).Scan(&product.ID, &product.Name, &product.Price, &product.TrackStock, &product.Stock)
 		
 		if err != nil {
 			return nil, fmt.Errorf("product %d not found", item.ProductID)
 		}
 
+		if product.TrackStock && product.Stock < item.Quantity {
+			if product.Stock <= 0 {
+				return nil, fmt.Errorf("%s is out of stock", product.Name)
+			}
+			return nil, fmt.Errorf("%s has only %d left in stock, %d ordered", product.Name, product.Stock, item.Quantity)
+		}
+
 		totalPrice := product.Price * float64(item.Quantity)
 
 		// Insert order
@@ -130,6 +144,23 @@ func (s *ProductService) AddOrderToSession(req *models.AddOrderRequest) ([]model
 			return nil, err
 		}
 
+		if product.TrackStock {
+			orderRef := uint(orderID)
+			level, err := moveStock(tx, &models.StockMovement{
+				ProductID: product.ID,
+				Kind:      StockOrder,
+				Quantity:  -item.Quantity,
+				OrderID:   &orderRef,
+				CreatedBy: uint(createdBy),
+			}, false)
+			if err != nil {
+				return nil, err
+			}
+			if level != nil {
+				lowStock = append(lowStock, level)
+			}
+		}
+
 		// Create order object
 		order := models.SessionOrder{
 			ID:          uint(orderID),
@@ -148,6 +179,13 @@ func (s *ProductService) AddOrderToSession(req *models.AddOrderRequest) ([]model
 		return nil, err
 	}
 
+	s.hub.Broadcast(realtime.EventOrderAdded, map[string]interface{}{
+		"session_id": req.SessionID,
+		"orders":     orders,
+	})
+	for _, level := range lowStock {
+		s.hub.Broadcast(realtime.EventStockLow, level)
+	}
 	return orders, nil
 }
 
@@ -155,7 +193,7 @@ func (s *ProductService) AddOrderToSession(req *models.AddOrderRequest) ([]model
 func (s *ProductService) GetSessionOrders(sessionID int) ([]models.SessionOrder, error) {
 	query := `
 		SELECT o.id, o.session_id, o.product_id, p.name as product_name,
-			   o.quantity, o.unit_price, o.total_price, o.status, o.ordered_at
+			   o.quantity, o.unit_price, o.total_price, o.status, COALESCE(o.note, ''), o.ordered_at
 		FROM session_orders o
 		JOIN products p ON o.product_id = p.id
 		WHERE o.session_id = ?
@@ -174,7 +212,7 @@ func (s *ProductService) GetSessionOrders(sessionID int) ([]models.SessionOrder,
 		err := rows.Scan(
 			&order.ID, &order.SessionID, &order.ProductID, &order.ProductName,
 			&order.Quantity, &order.UnitPrice, &order.TotalPrice, &order.Status,
-			&order.OrderedAt,
+			&order.Note, &order.OrderedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -185,12 +223,13 @@ func (s *ProductService) GetSessionOrders(sessionID int) ([]models.SessionOrder,
 	return orders, nil
 }
 
-// Create product
+// Create product. Whether its stock is tracked is chosen here; a tracked
+// product starts with no stock until goods are received.
 func (s *ProductService) CreateProduct(product *models.Product) (*models.Product, error) {
 	result, err := s.db.Exec(`
-		INSERT INTO products (name, category, price, description)
-		VALUES (?, ?, ?, ?)
-	`, product.Name, product.Category, product.Price, product.Description)
+		INSERT INTO products (name, category, price, description, track_stock, min_stock)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, product.Name, product.Category, product.Price, product.Description, product.TrackStock, product.MinStock)
 	
 	if err != nil {
 		return nil, err
@@ -201,8 +240,7 @@ func (s *ProductService) CreateProduct(product *models.Product) (*models.Product
 		return nil, err
 	}
 
-	product.ID = uint(id)
-	return product, nil
+	return scanProduct(s.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", id))
 }
 
 // Update product
@@ -217,8 +255,7 @@ func (s *ProductService) UpdateProduct(id int, product *models.Product) (*models
 		return nil, err
 	}
 
-	product.ID = uint(id)
-	return product, nil
+	return scanProduct(s.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", id))
 }
 
 // Delete product (soft delete)
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
+)
+
+// Kinds of stock movements
+const (
+	StockOrder       = "order"
+	StockOrderCancel = "order_cancel"
+	StockReceipt     = "receipt"
+	StockAdjustment  = "adjustment"
+)
+
+// Stock of a product after a movement, for low-stock alerts
+type stockLevel struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name"`
+	Stock     int    `json:"stock"`
+	MinStock  int    `json:"min_stock"`
+}
+
+// ReceiveStock records goods delivered by a supplier
+func (s *ProductService) ReceiveStock(productID int, req *models.GoodsReceiptRequest, createdBy int) (*models.StockMovement, error) {
+	return s.recordStockMovement(&models.StockMovement{
+		ProductID: uint(productID),
+		Kind:      StockReceipt,
+		Quantity:  req.Quantity,
+		Supplier:  strings.TrimSpace(req.Supplier),
+		UnitCost:  req.UnitCost,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: uint(createdBy),
+	})
+}
+
+// AdjustStock corrects a product's stock by a signed quantity, with a reason
+func (s *ProductService) AdjustStock(productID int, req *models.StockAdjustmentRequest, createdBy int) (*models.StockMovement, error) {
+	return s.recordStockMovement(&models.StockMovement{
+		ProductID: uint(productID),
+		Kind:      StockAdjustment,
+		Quantity:  req.Quantity,
+		Note:      strings.TrimSpace(req.Reason),
+		CreatedBy: uint(createdBy),
+	})
+}
+
+func (s *ProductService) recordStockMovement(movement *models.StockMovement) (*models.StockMovement, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	level, err := moveStock(tx, movement, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if level != nil {
+		s.hub.Broadcast(realtime.EventStockLow, level)
+	}
+	return movement, nil
+}
+
+// UpdateStockSettings turns stock tracking on or off for a product and sets
+// its low-stock threshold
+func (s *ProductService) UpdateStockSettings(productID int, req *models.StockSettingsRequest) (*models.Product, error) {
+	result, err := s.db.Exec(
+		"UPDATE products SET track_stock = ?, min_stock = ?, updated_at = NOW() WHERE id = ?",
+		*req.TrackStock, req.MinStock, productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		var exists bool
+		if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)", productID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("product not found")
+		}
+	}
+
+	return scanProduct(s.db.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", productID))
+}
+
+// GetStockMovements lists a product's stock movements newest first
+func (s *ProductService) GetStockMovements(productID int, limit int, offset int) ([]models.StockMovement, error) {
+	rows, err := s.db.Query(`
+		SELECT m.id, m.product_id, p.name, m.kind, m.quantity, m.stock_after, m.order_id,
+		       COALESCE(m.supplier, ''), COALESCE(m.unit_cost, 0), COALESCE(m.note, ''), m.created_by, m.created_at
+		FROM stock_movements m
+		JOIN products p ON p.id = m.product_id
+		WHERE m.product_id = ?
+		ORDER BY m.id DESC
+		LIMIT ? OFFSET ?
+	`, productID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		var movement models.StockMovement
+		err := rows.Scan(
+			&movement.ID, &movement.ProductID, &movement.ProductName, &movement.Kind, &movement.Quantity,
+			&movement.StockAfter, &movement.OrderID, &movement.Supplier, &movement.UnitCost, &movement.Note,
+			&movement.CreatedBy, &movement.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+
+	return movements, rows.Err()
+}
+
+// GetLowStockProducts lists active tracked products at or below their
+// low-stock threshold, emptiest first
+func (s *ProductService) GetLowStockProducts() ([]models.Product, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + productColumns + `
+		FROM products
+		WHERE is_active = true AND track_stock = true AND stock <= min_stock
+		ORDER BY stock, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, *product)
+	}
+
+	return products, rows.Err()
+}
+
+// CancelOrder cancels an order on a live session, puts what it took back in
+// stock and gives back any points it was paid with
+func (s *ProductService) CancelOrder(orderID int, cancelledBy int) (*models.SessionOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int
+	err = tx.QueryRow("SELECT session_id FROM session_orders WHERE id = ?", orderID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("order not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := lockLiveSession(tx, sessionID, "cancel orders on"); err != nil {
+		return nil, err
+	}
+
+	var order models.SessionOrder
+	err = tx.QueryRow(`
+		SELECT o.id, o.session_id, o.product_id, p.name, o.quantity, o.unit_price, o.total_price, o.status, o.ordered_at
+		FROM session_orders o
+		JOIN products p ON p.id = o.product_id
+		WHERE o.id = ? FOR UPDATE
+	`, orderID).Scan(
+		&order.ID, &order.SessionID, &order.ProductID, &order.ProductName, &order.Quantity,
+		&order.UnitPrice, &order.TotalPrice, &order.Status, &order.OrderedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == "cancelled" {
+		return nil, fmt.Errorf("order is already cancelled")
+	}
+
+	if _, err := tx.Exec("UPDATE session_orders SET status = 'cancelled' WHERE id = ?", orderID); err != nil {
+		return nil, err
+	}
+	order.Status = "cancelled"
+
+	// Only what the order actually took out of stock goes back, so an order
+	// placed while the product was untracked restores nothing
+	var taken int
+	err = tx.QueryRow("SELECT COALESCE(-SUM(quantity), 0) FROM stock_movements WHERE order_id = ?", orderID).Scan(&taken)
+	if err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		orderRef := uint(orderID)
+		_, err := moveStock(tx, &models.StockMovement{
+			ProductID: order.ProductID,
+			Kind:      StockOrderCancel,
+			Quantity:  taken,
+			OrderID:   &orderRef,
+			CreatedBy: uint(cancelledBy),
+		}, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := releaseOrderRedemption(tx, orderID, cancelledBy); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(realtime.EventOrderCancelled, map[string]interface{}{
+		"session_id": order.SessionID,
+		"order":      order,
+	})
+	return &order, nil
+}
+
+// moveStock applies a movement to a product's stock and records it in the
+// caller's transaction. Stock never goes below zero. Receipts and
+// adjustments need the product to be tracked (requireTracked). Returns the
+// product's level when the movement leaves it at or below its low-stock
+// threshold, nil otherwise.
+func moveStock(tx *sql.Tx, movement *models.StockMovement, requireTracked bool) (*stockLevel, error) {
+	var level stockLevel
+	var tracked bool
+	err := tx.QueryRow(
+		"SELECT id, name, track_stock, stock, min_stock FROM products WHERE id = ? FOR UPDATE",
+		movement.ProductID,
+	).Scan(&level.ProductID, &level.Name, &tracked, &level.Stock, &level.MinStock)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("product not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if requireTracked && !tracked {
+		return nil, fmt.Errorf("%s does not have its stock tracked", level.Name)
+	}
+
+	if level.Stock+movement.Quantity < 0 {
+		return nil, fmt.Errorf("%s has only %d in stock", level.Name, level.Stock)
+	}
+	level.Stock += movement.Quantity
+	movement.StockAfter = level.Stock
+	movement.ProductName = level.Name
+
+	if _, err := tx.Exec("UPDATE products SET stock = ? WHERE id = ?", level.Stock, level.ProductID); err != nil {
+		return nil, err
+	}
+
+	var unitCost interface{}
+	if movement.Kind == StockReceipt {
+		unitCost = movement.UnitCost
+	}
+	result, err := tx.Exec(`
+		INSERT INTO stock_movements (product_id, kind, quantity, stock_after, order_id, supplier, unit_cost, note, created_by)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), ?)
+	`, movement.ProductID, movement.Kind, movement.Quantity, movement.StockAfter, movement.OrderID,
+		movement.Supplier, unitCost, movement.Note, movement.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	movement.ID = uint(id)
+
+	if tracked && level.Stock <= level.MinStock {
+		return &level, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,537 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"bi-a-management/internal/billing"
+	"bi-a-management/internal/models"
+)
+
+type PromotionService struct {
+	db *sql.DB
+}
+
+func NewPromotionService(db *sql.DB) *PromotionService {
+	return &PromotionService{db: db}
+}
+
+const promotionColumns = `
+	id, name, COALESCE(code, ''), kind, value, max_discount, target, COALESCE(category, ''),
+	starts_at, ends_at, usage_limit, usage_count, is_active, created_at, updated_at
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPromotion(row rowScanner) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := row.Scan(
+		&promotion.ID, &promotion.Name, &promotion.Code, &promotion.Kind, &promotion.Value,
+		&promotion.MaxDiscount, &promotion.Target, &promotion.Category, &promotion.StartsAt, &promotion.EndsAt,
+		&promotion.UsageLimit, &promotion.UsageCount, &promotion.IsActive, &promotion.CreatedAt, &promotion.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// Get all promotions
+func (s *PromotionService) GetPromotions() ([]models.Promotion, error) {
+	rows, err := s.db.Query("SELECT " + promotionColumns + " FROM promotions ORDER BY is_active DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, *promotion)
+	}
+
+	return promotions, rows.Err()
+}
+
+// Get promotion by ID
+func (s *PromotionService) GetPromotionByID(id int) (*models.Promotion, error) {
+	promotion, err := scanPromotion(s.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("promotion not found")
+	}
+	return promotion, err
+}
+
+// Create promotion
+func (s *PromotionService) CreatePromotion(req *models.PromotionRequest) (*models.Promotion, error) {
+	if err := validatePromotion(s.db, 0, req); err != nil {
+		return nil, err
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO promotions (name, code, kind, value, max_discount, target, category, starts_at, ends_at, usage_limit, is_active)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)
+	`, req.Name, req.Code, req.Kind, req.Value, req.MaxDiscount, req.Target, req.Category,
+		req.StartsAt, req.EndsAt, req.UsageLimit, isActive)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetPromotionByID(int(id))
+}
+
+// Update promotion. The usage count is kept.
+func (s *PromotionService) UpdatePromotion(id int, req *models.PromotionRequest) (*models.Promotion, error) {
+	if _, err := s.GetPromotionByID(id); err != nil {
+		return nil, err
+	}
+
+	if err := validatePromotion(s.db, id, req); err != nil {
+		return nil, err
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	_, err := s.db.Exec(`
+		UPDATE promotions
+		SET name = ?, code = NULLIF(?, ''), kind = ?, value = ?, max_discount = ?, target = ?,
+		    category = NULLIF(?, ''), starts_at = ?, ends_at = ?, usage_limit = ?, is_active = ?
+		WHERE id = ?
+	`, req.Name, req.Code, req.Kind, req.Value, req.MaxDiscount, req.Target, req.Category,
+		req.StartsAt, req.EndsAt, req.UsageLimit, isActive, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetPromotionByID(id)
+}
+
+// Delete promotion. Invoices keep their own copy of the discounts they got.
+func (s *PromotionService) DeletePromotion(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM promotions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("promotion not found")
+	}
+
+	if _, err := tx.Exec("DELETE FROM session_promotions WHERE promotion_id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func validatePromotion(q sessionQueryer, id int, req *models.PromotionRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	req.Category = strings.TrimSpace(req.Category)
+
+	if req.Kind == "percentage" && req.Value > 100 {
+		return fmt.Errorf("a percentage promotion cannot exceed 100")
+	}
+	if req.Kind != "percentage" {
+		req.MaxDiscount = 0
+	}
+
+	if req.Target == "category" && req.Category == "" {
+		return fmt.Errorf("category is required for a category promotion")
+	}
+	if req.Target != "category" {
+		req.Category = ""
+	}
+
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	if req.Code != "" {
+		var taken bool
+		err := q.QueryRow("SELECT EXISTS(SELECT 1 FROM promotions WHERE code = ? AND id != ?)", req.Code, id).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return fmt.Errorf("promotion code %s is already in use", req.Code)
+		}
+	}
+	return nil
+}
+
+// Enter a promotion code on a session that is still on a table
+func (s *PromotionService) ApplyPromotionCode(sessionID int, code string, addedBy int) (*models.Promotion, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockLiveSession(tx, sessionID, "add a promotion to"); err != nil {
+		return nil, err
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	promotion, err := scanPromotion(tx.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE code = ?", code))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("promotion code not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !billing.PromotionApplies(*promotion, time.Now()) {
+		return nil, fmt.Errorf("promotion %s is inactive, outside its dates or used up", promotion.Code)
+	}
+
+	_, err = tx.Exec(
+		"INSERT IGNORE INTO session_promotions (session_id, promotion_id, added_by) VALUES (?, ?, ?)",
+		sessionID, promotion.ID, addedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return promotion, nil
+}
+
+// Take a promotion code back off a session
+func (s *PromotionService) RemovePromotionFromSession(sessionID int, promotionID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockLiveSession(tx, sessionID, "remove a promotion from"); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM session_promotions WHERE session_id = ? AND promotion_id = ?", sessionID, promotionID)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("promotion is not on this session")
+	}
+
+	return tx.Commit()
+}
+
+// Grant a manual discount on a session, replacing any earlier one
+func (s *PromotionService) SetSessionDiscount(sessionID int, req *models.ManualDiscountRequest, approvedBy int) (*models.SessionDiscount, error) {
+	if (req.Amount > 0) == (req.Percent > 0) {
+		return nil, fmt.Errorf("set either amount or percent")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockLiveSession(tx, sessionID, "discount"); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		REPLACE INTO session_discounts (session_id, amount, percent, reason, approved_by)
+		VALUES (?, ?, ?, ?, ?)
+	`, sessionID, req.Amount, req.Percent, req.Reason, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	discount, err := loadSessionDiscount(s.db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return discount, nil
+}
+
+// Remove the manual discount of a session
+func (s *PromotionService) ClearSessionDiscount(sessionID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := lockLiveSession(tx, sessionID, "remove the discount from"); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM session_discounts WHERE session_id = ?", sessionID)
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("session has no discount")
+	}
+
+	return tx.Commit()
+}
+
+// Discounts given on invoices created between two dates (inclusive), per
+// promotion and per member tier, plus every manual discount with its reason
+// and approver and the total paid with loyalty points. Voided invoices are
+// left out.
+func (s *PromotionService) GetDiscountReport(from string, to string) (map[string]interface{}, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(d.promotion_id, 0), COALESCE(d.code, ''), d.name,
+		       COUNT(DISTINCT d.invoice_id), COALESCE(SUM(d.amount), 0)
+		FROM invoice_discounts d
+		JOIN invoices i ON i.id = d.invoice_id
+		WHERE d.kind = 'promotion' AND DATE(i.created_at) BETWEEN ? AND ?
+		  AND COALESCE(i.payment_status, 'pending') != 'cancelled'
+		GROUP BY COALESCE(d.promotion_id, 0), COALESCE(d.code, ''), d.name
+		ORDER BY 5 DESC
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []map[string]interface{}{}
+	var total float64
+	for rows.Next() {
+		var promotionID, invoices int
+		var code, name string
+		var amount float64
+		if err := rows.Scan(&promotionID, &code, &name, &invoices, &amount); err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, map[string]interface{}{
+			"promotion_id":   promotionID,
+			"code":           code,
+			"name":           name,
+			"total_invoices": invoices,
+			"total_discount": amount,
+		})
+		total += amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	manualRows, err := s.db.Query(`
+		SELECT d.invoice_id, COALESCE(d.reason, ''), COALESCE(u.username, ''), d.amount, i.created_at
+		FROM invoice_discounts d
+		JOIN invoices i ON i.id = d.invoice_id
+		LEFT JOIN users u ON u.id = d.approved_by
+		WHERE d.kind = 'manual' AND DATE(i.created_at) BETWEEN ? AND ?
+		  AND COALESCE(i.payment_status, 'pending') != 'cancelled'
+		ORDER BY i.created_at
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer manualRows.Close()
+
+	manual := []map[string]interface{}{}
+	var manualTotal float64
+	for manualRows.Next() {
+		var invoiceID int
+		var reason, approvedBy string
+		var amount float64
+		var createdAt time.Time
+		if err := manualRows.Scan(&invoiceID, &reason, &approvedBy, &amount, &createdAt); err != nil {
+			return nil, err
+		}
+		manual = append(manual, map[string]interface{}{
+			"invoice_id":  invoiceID,
+			"reason":      reason,
+			"approved_by": approvedBy,
+			"amount":      amount,
+			"created_at":  createdAt,
+		})
+		manualTotal += amount
+	}
+	if err := manualRows.Err(); err != nil {
+		return nil, err
+	}
+
+	memberRows, err := s.db.Query(`
+		SELECT COALESCE(d.code, ''), d.name, COUNT(DISTINCT d.invoice_id), COALESCE(SUM(d.amount), 0)
+		FROM invoice_discounts d
+		JOIN invoices i ON i.id = d.invoice_id
+		WHERE d.kind = 'member' AND DATE(i.created_at) BETWEEN ? AND ?
+		  AND COALESCE(i.payment_status, 'pending') != 'cancelled'
+		GROUP BY COALESCE(d.code, ''), d.name
+		ORDER BY 4 DESC
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+
+	members := []map[string]interface{}{}
+	var memberTotal float64
+	for memberRows.Next() {
+		var tier, name string
+		var invoices int
+		var amount float64
+		if err := memberRows.Scan(&tier, &name, &invoices, &amount); err != nil {
+			return nil, err
+		}
+		members = append(members, map[string]interface{}{
+			"tier":           tier,
+			"name":           name,
+			"total_invoices": invoices,
+			"total_discount": amount,
+		})
+		memberTotal += amount
+	}
+	if err := memberRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pointsInvoices int
+	var pointsTotal float64
+	err = s.db.QueryRow(`
+		SELECT COUNT(DISTINCT d.invoice_id), COALESCE(SUM(d.amount), 0)
+		FROM invoice_discounts d
+		JOIN invoices i ON i.id = d.invoice_id
+		WHERE d.kind = 'points' AND DATE(i.created_at) BETWEEN ? AND ?
+		  AND COALESCE(i.payment_status, 'pending') != 'cancelled'
+	`, from, to).Scan(&pointsInvoices, &pointsTotal)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"from":                  from,
+		"to":                    to,
+		"total_discount":        total + manualTotal + memberTotal + pointsTotal,
+		"promotions":            promotions,
+		"total_manual_discount": manualTotal,
+		"manual_discounts":      manual,
+		"total_member_discount": memberTotal,
+		"member_discounts":      members,
+		"total_points_discount": pointsTotal,
+		"points_invoices":       pointsInvoices,
+	}, nil
+}
+
+// Automatic promotions plus those entered on the session. Whether each still
+// applies (dates, usage) is decided when the session is priced.
+func loadSessionPromotions(q sessionQueryer, sessionID int) ([]models.Promotion, error) {
+	rows, err := q.Query(`
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE is_active = true
+		  AND (code IS NULL OR id IN (SELECT promotion_id FROM session_promotions WHERE session_id = ?))
+		ORDER BY id
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []models.Promotion
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, *promotion)
+	}
+
+	return promotions, rows.Err()
+}
+
+// The manual discount of a session, nil if it has none
+func loadSessionDiscount(q sessionQueryer, sessionID int) (*models.SessionDiscount, error) {
+	var discount models.SessionDiscount
+	err := q.QueryRow(`
+		SELECT session_id, amount, percent, reason, approved_by, created_at
+		FROM session_discounts WHERE session_id = ?
+	`, sessionID).Scan(
+		&discount.SessionID, &discount.Amount, &discount.Percent, &discount.Reason,
+		&discount.ApprovedBy, &discount.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &discount, nil
+}
+
+// Record the discounts an invoice got and count one use of each promotion,
+// refusing a promotion that ran out since the session was priced
+func recordInvoiceDiscounts(tx *sql.Tx, invoiceID int64, discounts []billing.AppliedDiscount) error {
+	used := make(map[uint]bool)
+	for _, discount := range discounts {
+		var promotionID, approvedBy interface{}
+		if discount.PromotionID != 0 {
+			promotionID = discount.PromotionID
+		}
+		if discount.ApprovedBy != 0 {
+			approvedBy = discount.ApprovedBy
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO invoice_discounts (invoice_id, kind, promotion_id, code, name, reason, approved_by, amount)
+			VALUES (?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), ?, ?)
+		`, invoiceID, discount.Kind, promotionID, discount.Code, discount.Name, discount.Reason, approvedBy, discount.Amount)
+		if err != nil {
+			return err
+		}
+
+		if discount.PromotionID == 0 || used[discount.PromotionID] {
+			continue
+		}
+		used[discount.PromotionID] = true
+
+		result, err := tx.Exec(`
+			UPDATE promotions SET usage_count = usage_count + 1
+			WHERE id = ? AND (usage_limit = 0 OR usage_count < usage_limit)
+		`, discount.PromotionID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return fmt.Errorf("promotion %s has reached its usage limit", discount.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
+)
+
+// A booked reservation whose hold window is running. Expects the reservations
+// table to be aliased as r.
+const reservationHoldingCondition = "r.status = 'booked' AND NOW() BETWEEN r.hold_from AND r.hold_until"
+
+const reservationColumns = `
+	r.id, r.table_id, t.name, COALESCE(r.table_type, ''), r.customer_name, r.phone,
+	r.start_time, r.duration_minutes, r.hold_from, r.hold_until, r.status,
+	COALESCE(r.note, ''), r.session_id, r.created_by, r.created_at, r.updated_at`
+
+type ReservationService struct {
+	db            *sql.DB
+	hub           *realtime.Hub
+	tableService  *TableService
+	holdWindow    time.Duration
+	noShowTimeout time.Duration
+}
+
+func NewReservationService(db *sql.DB, hub *realtime.Hub, tableService *TableService, holdWindow, noShowTimeout time.Duration) *ReservationService {
+	return &ReservationService{
+		db:            db,
+		hub:           hub,
+		tableService:  tableService,
+		holdWindow:    holdWindow,
+		noShowTimeout: noShowTimeout,
+	}
+}
+
+// Reservations starting on the given day, optionally for a single table
+func (s *ReservationService) GetReservations(date time.Time, tableID int) ([]models.Reservation, error) {
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM reservations r
+		JOIN tables t ON r.table_id = t.id
+		WHERE r.start_time >= ? AND r.start_time < ?`
+	args := []interface{}{dayStart, dayStart.AddDate(0, 0, 1)}
+	if tableID > 0 {
+		query += " AND r.table_id = ?"
+		args = append(args, tableID)
+	}
+	query += " ORDER BY r.start_time, t.name"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []models.Reservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, *reservation)
+	}
+
+	return reservations, rows.Err()
+}
+
+func (s *ReservationService) GetReservationByID(id int) (*models.Reservation, error) {
+	row := s.db.QueryRow(`
+		SELECT `+reservationColumns+`
+		FROM reservations r
+		JOIN tables t ON r.table_id = t.id
+		WHERE r.id = ?
+	`, id)
+
+	reservation, err := scanReservation(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("reservation not found")
+	}
+	return reservation, err
+}
+
+func scanReservation(row interface{ Scan(...interface{}) error }) (*models.Reservation, error) {
+	var reservation models.Reservation
+	err := row.Scan(
+		&reservation.ID, &reservation.TableID, &reservation.TableName, &reservation.TableType,
+		&reservation.CustomerName, &reservation.Phone, &reservation.StartTime, &reservation.DurationMinutes,
+		&reservation.HoldFrom, &reservation.HoldUntil, &reservation.Status, &reservation.Note,
+		&reservation.SessionID, &reservation.CreatedBy, &reservation.CreatedAt, &reservation.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation.EndTime = reservation.StartTime.Add(time.Duration(reservation.DurationMinutes) * time.Minute)
+	return &reservation, nil
+}
+
+// Book a table, or any free table of the requested type
+func (s *ReservationService) CreateReservation(req *models.ReservationRequest, createdBy int) (*models.Reservation, error) {
+	if !req.StartTime.After(time.Now()) {
+		return nil, fmt.Errorf("start_time must be in the future")
+	}
+
+	// The table rows picked are locked until the booking is saved, so two
+	// clerks booking the same slot cannot both pass the conflict check
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tableID, err := s.pickTable(tx, req, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	holdFrom, holdUntil := s.holdWindowFor(req.StartTime)
+	result, err := tx.Exec(`
+		INSERT INTO reservations
+		(table_id, table_type, customer_name, phone, start_time, duration_minutes, hold_from, hold_until, note, created_by)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?)
+	`, tableID, req.TableType, req.CustomerName, req.Phone, req.StartTime, req.DurationMinutes,
+		holdFrom, holdUntil, req.Note, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := s.SyncTableHolds(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastReservation(int(id))
+}
+
+// Move a booking to another time, table or duration
+func (s *ReservationService) UpdateReservation(id int, req *models.ReservationRequest) (*models.Reservation, error) {
+	if !req.StartTime.After(time.Now()) {
+		return nil, fmt.Errorf("start_time must be in the future")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM reservations WHERE id = ? FOR UPDATE", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("reservation not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status != "booked" {
+		return nil, fmt.Errorf("only booked reservations can be changed")
+	}
+
+	tableID, err := s.pickTable(tx, req, id)
+	if err != nil {
+		return nil, err
+	}
+
+	holdFrom, holdUntil := s.holdWindowFor(req.StartTime)
+	_, err = tx.Exec(`
+		UPDATE reservations
+		SET table_id = ?, table_type = NULLIF(?, ''), customer_name = ?, phone = ?, start_time = ?,
+		    duration_minutes = ?, hold_from = ?, hold_until = ?, note = NULLIF(?, ''), updated_at = NOW()
+		WHERE id = ? AND status = 'booked'
+	`, tableID, req.TableType, req.CustomerName, req.Phone, req.StartTime,
+		req.DurationMinutes, holdFrom, holdUntil, req.Note, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := s.SyncTableHolds(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastReservation(id)
+}
+
+func (s *ReservationService) CancelReservation(id int) (*models.Reservation, error) {
+	result, err := s.db.Exec(
+		"UPDATE reservations SET status = 'cancelled', updated_at = NOW() WHERE id = ? AND status = 'booked'",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := s.GetReservationByID(id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("only booked reservations can be cancelled")
+	}
+
+	if err := s.SyncTableHolds(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastReservation(id)
+}
+
+// Turn a booking into a running session on its table
+func (s *ReservationService) SeatReservation(id int, req *models.SeatReservationRequest, createdBy int) (*models.TableSession, error) {
+	reservation, err := s.GetReservationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if reservation.Status != "booked" {
+		return nil, fmt.Errorf("only booked reservations can be seated")
+	}
+
+	sessionType := req.SessionType
+	if sessionType == "" {
+		sessionType = "fixed_time"
+	}
+	presetDuration := req.PresetDurationMinutes
+	if presetDuration == 0 {
+		presetDuration = reservation.DurationMinutes
+	}
+
+	session, err := s.tableService.StartSession(&models.StartSessionRequest{
+		TableID:               reservation.TableID,
+		CustomerName:          reservation.CustomerName,
+		Phone:                 reservation.Phone,
+		PresetDurationMinutes: presetDuration,
+		PrepaidAmount:         req.PrepaidAmount,
+		SessionType:           sessionType,
+		ReservationID:         reservation.ID,
+	}, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.broadcastReservation(id); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Mark bookings nobody turned up for as no-shows and keep table statuses in
+// line with the bookings that currently hold them
+func (s *ReservationService) ProcessReservations() error {
+	rows, err := s.db.Query("SELECT id FROM reservations WHERE status = 'booked' AND hold_until < NOW()")
+	if err != nil {
+		return err
+	}
+
+	var overdue []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		overdue = append(overdue, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range overdue {
+		result, err := s.db.Exec(
+			"UPDATE reservations SET status = 'no_show', updated_at = NOW() WHERE id = ? AND status = 'booked'",
+			id,
+		)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+		if _, err := s.broadcastReservation(id); err != nil {
+			return err
+		}
+	}
+
+	if len(overdue) > 0 {
+		log.Printf("Marked %d reservations as no-show", len(overdue))
+	}
+
+	return s.SyncTableHolds()
+}
+
+// Put free tables with a running hold on reserved, and release reserved
+// tables whose hold has ended
+func (s *ReservationService) SyncTableHolds() error {
+	_, err := s.db.Exec(`
+		UPDATE tables t SET t.status = 'reserved'
+		WHERE t.status = 'available'
+		  AND EXISTS (SELECT 1 FROM reservations r WHERE r.table_id = t.id AND ` + reservationHoldingCondition + `)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE tables t SET t.status = 'available'
+		WHERE t.status = 'reserved'
+		  AND NOT EXISTS (SELECT 1 FROM reservations r WHERE r.table_id = t.id AND ` + reservationHoldingCondition + `)
+	`)
+	return err
+}
+
+// Run ProcessReservations on a fixed interval until the process exits
+func (s *ReservationService) RunReservationTicker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.ProcessReservations(); err != nil {
+			log.Printf("Reservation ticker error: %v", err)
+		}
+	}
+}
+
+func (s *ReservationService) holdWindowFor(start time.Time) (time.Time, time.Time) {
+	return start.Add(-s.holdWindow), start.Add(s.noShowTimeout)
+}
+
+// The table a booking goes on: the one asked for, or the first table of the
+// requested type that is free for the whole slot. Each table is locked inside
+// tx before its bookings are checked, so bookings and session starts on the
+// same table wait for each other.
+func (s *ReservationService) pickTable(tx *sql.Tx, req *models.ReservationRequest, excludeID int) (uint, error) {
+	end := req.StartTime.Add(time.Duration(req.DurationMinutes) * time.Minute)
+
+	if req.TableID != 0 {
+		var status string
+		err := tx.QueryRow("SELECT status FROM tables WHERE id = ? FOR UPDATE", req.TableID).Scan(&status)
+		if err != nil {
+			return 0, fmt.Errorf("table not found")
+		}
+		if status == "maintenance" || status == "retired" {
+			return 0, fmt.Errorf("table is out of service")
+		}
+		if err := s.checkConflicts(tx, req.TableID, req.StartTime, end, excludeID); err != nil {
+			return 0, err
+		}
+		return req.TableID, nil
+	}
+
+	tableType := strings.TrimSpace(req.TableType)
+	if tableType == "" {
+		return 0, fmt.Errorf("table_id or table_type is required")
+	}
+
+	rows, err := tx.Query(
+		"SELECT id FROM tables WHERE table_type = ? AND status NOT IN ('maintenance', 'retired') ORDER BY display_order, name",
+		tableType,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var candidates []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		candidates = append(candidates, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(candidates) == 0 {
+		return 0, fmt.Errorf("no tables of type %s", tableType)
+	}
+
+	for _, id := range candidates {
+		var status string
+		err := tx.QueryRow("SELECT status FROM tables WHERE id = ? FOR UPDATE", id).Scan(&status)
+		if err != nil {
+			return 0, err
+		}
+		if status == "maintenance" || status == "retired" {
+			continue
+		}
+		if err := s.checkConflicts(tx, id, req.StartTime, end, excludeID); err == nil {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no %s table is free at that time", tableType)
+}
+
+// A slot on a table conflicts with an overlapping booking, or with a session
+// that will still be playing when the slot starts
+func (s *ReservationService) checkConflicts(q sessionQueryer, tableID uint, start, end time.Time, excludeID int) error {
+	var otherStart time.Time
+	var otherDuration int
+	err := q.QueryRow(`
+		SELECT start_time, duration_minutes
+		FROM reservations
+		WHERE table_id = ? AND status = 'booked' AND id != ?
+		  AND start_time < ? AND DATE_ADD(start_time, INTERVAL duration_minutes MINUTE) > ?
+		ORDER BY start_time
+		LIMIT 1
+	`, tableID, excludeID, end, start).Scan(&otherStart, &otherDuration)
+	if err == nil {
+		otherEnd := otherStart.Add(time.Duration(otherDuration) * time.Minute)
+		return fmt.Errorf("table is already booked from %s to %s", otherStart.Format("15:04"), otherEnd.Format("15:04"))
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var sessionID int
+	err = q.QueryRow(`
+		SELECT id FROM table_sessions
+		WHERE table_id = ? AND status IN ('active', 'paused', 'overtime')
+		LIMIT 1
+	`, tableID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	session, err := loadSession(q, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Only a fixed_time session on the clock has a known end; anything else
+	// is assumed to keep the table until the hold window would begin
+	now := time.Now()
+	busyUntil := now.Add(s.holdWindow)
+	if session.SessionType == "fixed_time" && session.Status != "overtime" && session.RemainingMinutes != nil {
+		busyUntil = now.Add(time.Duration(*session.RemainingMinutes) * time.Minute)
+	}
+	if start.Before(busyUntil) {
+		return fmt.Errorf("table is in use until about %s", busyUntil.Format("15:04"))
+	}
+
+	return nil
+}
+
+// Reload a reservation after a change and push it to the board
+func (s *ReservationService) broadcastReservation(id int) (*models.Reservation, error) {
+	reservation, err := s.GetReservationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(realtime.EventReservationUpdated, reservation)
+	return reservation, nil
+}
+
+// The booking whose hold window is running on a table, 0 if none
+func holdingReservation(q sessionQueryer, tableID uint) (uint, error) {
+	var id uint
+	err := q.QueryRow(
+		"SELECT r.id FROM reservations r WHERE r.table_id = ? AND "+reservationHoldingCondition+" ORDER BY r.start_time LIMIT 1",
+		tableID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// The status a table goes back to when its session leaves it: reserved while
+// a booking holds it, available otherwise
+func releasedTableStatus(q sessionQueryer, tableID uint) (string, error) {
+	var held int
+	err := q.QueryRow(
+		"SELECT COUNT(*) FROM reservations r WHERE r.table_id = ? AND "+reservationHoldingCondition,
+		tableID,
+	).Scan(&held)
+	if err != nil {
+		return "", err
+	}
+
+	if held > 0 {
+		return "reserved", nil
+	}
+	return "available", nil
+}
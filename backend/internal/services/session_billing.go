@@ -0,0 +1,186 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"bi-a-management/internal/billing"
+	"bi-a-management/internal/models"
+)
+
+// sessionQueryer is satisfied by both *sql.DB and *sql.Tx
+type sessionQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Load the closed segments of a session followed by the open segment on its
+// current table. A session that was never transferred has a single segment.
+func loadSessionSegments(q sessionQueryer, session *models.TableSession) ([]models.SessionSegment, error) {
+	rows, err := q.Query(`
+		SELECT g.id, g.session_id, g.table_id, t.name, COALESCE(t.table_type, ''), COALESCE(t.zone, ''),
+		       g.hourly_rate, g.started_at, g.ended_at
+		FROM session_segments g
+		JOIN tables t ON g.table_id = t.id
+		WHERE g.session_id = ?
+		ORDER BY g.started_at, g.id
+	`, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []models.SessionSegment
+	openFrom := session.StartTime
+	for rows.Next() {
+		var segment models.SessionSegment
+		err := rows.Scan(
+			&segment.ID, &segment.SessionID, &segment.TableID, &segment.TableName,
+			&segment.TableType, &segment.Zone, &segment.HourlyRate, &segment.StartedAt, &segment.EndedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if segment.EndedAt != nil {
+			openFrom = *segment.EndedAt
+		}
+		segments = append(segments, segment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	current := models.SessionSegment{
+		SessionID:  session.ID,
+		TableID:    session.TableID,
+		TableName:  session.TableName,
+		HourlyRate: session.HourlyRate,
+		StartedAt:  openFrom,
+	}
+	err = q.QueryRow(
+		"SELECT COALESCE(table_type, ''), COALESCE(zone, '') FROM tables WHERE id = ?", session.TableID,
+	).Scan(&current.TableType, &current.Zone)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	segments = append(segments, current)
+
+	return segments, nil
+}
+
+// Load the pause intervals of a session
+func loadSessionPauses(q sessionQueryer, sessionID int) ([]models.SessionPause, error) {
+	rows, err := q.Query(`
+		SELECT id, session_id, paused_at, resumed_at, paused_by, resumed_by
+		FROM session_pauses
+		WHERE session_id = ?
+		ORDER BY paused_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pauses []models.SessionPause
+	for rows.Next() {
+		var pause models.SessionPause
+		err := rows.Scan(
+			&pause.ID, &pause.SessionID, &pause.PausedAt, &pause.ResumedAt,
+			&pause.PausedBy, &pause.ResumedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, pause)
+	}
+
+	return pauses, rows.Err()
+}
+
+// Load the orders of a session that are billed (everything but cancelled)
+func loadBillableOrders(q sessionQueryer, sessionID int) ([]models.SessionOrder, error) {
+	rows, err := q.Query(`
+		SELECT o.id, o.session_id, o.product_id, p.name, COALESCE(p.category, ''), o.quantity, o.unit_price,
+		       o.total_price, o.status, COALESCE(o.note, ''), o.ordered_at
+		FROM session_orders o
+		JOIN products p ON o.product_id = p.id
+		WHERE o.session_id = ? AND o.status != 'cancelled'
+		ORDER BY o.ordered_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.SessionOrder
+	for rows.Next() {
+		var order models.SessionOrder
+		err := rows.Scan(
+			&order.ID, &order.SessionID, &order.ProductID, &order.ProductName, &order.Category, &order.Quantity,
+			&order.UnitPrice, &order.TotalPrice, &order.Status, &order.Note, &order.OrderedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// Gather everything the billing package needs and price the session up to end
+func quoteSession(q sessionQueryer, policy billing.Policy, session *models.TableSession, end time.Time) (*billing.Quote, error) {
+	segments, err := loadSessionSegments(q, session)
+	if err != nil {
+		return nil, err
+	}
+
+	pauses, err := loadSessionPauses(q, int(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := loadBillableOrders(q, int(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := loadPricingRules(q, true)
+	if err != nil {
+		return nil, err
+	}
+
+	redemptions, err := loadSessionRedemptions(q, int(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	tier, err := loadCustomerTier(q, session.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	promotions, err := loadSessionPromotions(q, int(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	manual, err := loadSessionDiscount(q, int(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return billing.Calculate(billing.Input{
+		Session:  *session,
+		Segments: segments,
+		Pauses:   pauses,
+		Orders:   orders,
+		Rules:    rules,
+		End:      end,
+
+		Redemptions:    redemptions,
+		MemberTier:     tier,
+		Promotions:     promotions,
+		ManualDiscount: manual,
+	}, policy), nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Session statuses. expired is only found on sessions closed before overtime
+// billing existed; it is treated like completed.
+const (
+	SessionActive    = "active"
+	SessionPaused    = "paused"
+	SessionOvertime  = "overtime"
+	SessionCompleted = "completed"
+	SessionExpired   = "expired"
+)
+
+// SessionInvoiced is not stored on a session: it is the status reported in a
+// SessionStateError when a closed session already has an invoice
+const SessionInvoiced = "invoiced"
+
+// Status changes a session may make. completed and expired are final.
+var sessionTransitions = map[string][]string{
+	SessionActive:   {SessionPaused, SessionOvertime, SessionCompleted},
+	SessionPaused:   {SessionActive, SessionCompleted},
+	SessionOvertime: {SessionActive, SessionCompleted},
+}
+
+// What moving a session to a status is called, for error messages
+var sessionActions = map[string]string{
+	SessionActive:    "resume",
+	SessionPaused:    "pause",
+	SessionOvertime:  "flag overtime on",
+	SessionCompleted: "end",
+}
+
+// SessionStateError is returned when a session is asked to do something its
+// current status does not allow, typically because another request changed
+// it first. Handlers answer it with 409 Conflict.
+type SessionStateError struct {
+	SessionID int
+	Status    string
+	Action    string
+}
+
+func (e *SessionStateError) Error() string {
+	return fmt.Sprintf("cannot %s session %d: it is %s", e.Action, e.SessionID, e.Status)
+}
+
+// Whether a session is still on a table: running, paused or in overtime
+func isLiveSession(status string) bool {
+	return status == SessionActive || status == SessionPaused || status == SessionOvertime
+}
+
+func canMoveSession(from string, to string) bool {
+	for _, next := range sessionTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Lock a session row for the rest of the transaction and return its status.
+// Concurrent requests on the same session wait here, then see the status the
+// first one left.
+func lockSession(tx *sql.Tx, sessionID int) (string, error) {
+	var status string
+	err := tx.QueryRow("SELECT status FROM table_sessions WHERE id = ? FOR UPDATE", sessionID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("session not found")
+	}
+	return status, err
+}
+
+// Lock a session that must still be on a table for action (transfer, order
+// for...)
+func lockLiveSession(tx *sql.Tx, sessionID int, action string) (string, error) {
+	status, err := lockSession(tx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if !isLiveSession(status) {
+		return "", &SessionStateError{SessionID: sessionID, Status: status, Action: action}
+	}
+	return status, nil
+}
+
+// Lock a session and move it to status to, if its current status allows it.
+// Returns the status it had.
+func moveSession(tx *sql.Tx, sessionID int, to string) (string, error) {
+	from, err := lockSession(tx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	if !canMoveSession(from, to) {
+		return "", &SessionStateError{SessionID: sessionID, Status: from, Action: sessionActions[to]}
+	}
+
+	_, err = tx.Exec("UPDATE table_sessions SET status = ?, updated_at = NOW() WHERE id = ?", to, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return from, nil
+}
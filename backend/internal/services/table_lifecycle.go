@@ -0,0 +1,393 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
+)
+
+const tableColumns = `
+	id, name, status, COALESCE(table_type, ''), COALESCE(zone, ''), display_order,
+	hourly_rate, cleaning_until, created_at, updated_at`
+
+// Status changes staff may make by hand. occupied and reserved are set by
+// sessions and bookings, retired by RetireTable.
+var tableTransitions = map[string][]string{
+	"available":   {"cleaning", "maintenance"},
+	"reserved":    {"maintenance"},
+	"cleaning":    {"available", "maintenance"},
+	"maintenance": {"available"},
+	"retired":     {"available"},
+}
+
+func scanTable(row interface{ Scan(...interface{}) error }) (*models.Table, error) {
+	var table models.Table
+	err := row.Scan(
+		&table.ID, &table.Name, &table.Status, &table.TableType, &table.Zone, &table.DisplayOrder,
+		&table.HourlyRate, &table.CleaningUntil, &table.CreatedAt, &table.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// Get table by ID
+func (s *TableService) GetTableByID(id int) (*models.Table, error) {
+	table, err := scanTable(s.db.QueryRow("SELECT "+tableColumns+" FROM tables WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("table not found")
+	}
+	return table, err
+}
+
+// Add a table to the hall
+func (s *TableService) CreateTable(req *models.TableRequest) (*models.Table, error) {
+	name := strings.TrimSpace(req.Name)
+	if err := s.checkTableName(name, 0); err != nil {
+		return nil, err
+	}
+
+	tableType, zone, hourlyRate, err := s.tablePlacement(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO tables (name, status, table_type, zone, display_order, hourly_rate)
+		VALUES (?, 'available', NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+	`, name, tableType, zone, req.DisplayOrder, hourlyRate)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.broadcastTable(int(id))
+}
+
+// Rename, re-type, move or re-price a table. A new rate applies to sessions
+// started afterwards.
+func (s *TableService) UpdateTable(id int, req *models.TableRequest) (*models.Table, error) {
+	if _, err := s.GetTableByID(id); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if err := s.checkTableName(name, id); err != nil {
+		return nil, err
+	}
+
+	tableType, zone, hourlyRate, err := s.tablePlacement(req)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE tables
+		SET name = ?, table_type = NULLIF(?, ''), zone = NULLIF(?, ''), display_order = ?, hourly_rate = ?, updated_at = NOW()
+		WHERE id = ?
+	`, name, tableType, zone, req.DisplayOrder, hourlyRate, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.broadcastTable(id)
+}
+
+// Type, zone and rate of a table being saved. The type and zone must be set
+// up; without a rate the table takes its type's default rate.
+func (s *TableService) tablePlacement(req *models.TableRequest) (string, string, float64, error) {
+	tableType := strings.TrimSpace(req.TableType)
+	zone := strings.TrimSpace(req.Zone)
+
+	defaultRate, err := defaultHourlyRate(s.db, tableType)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if err := checkZone(s.db, zone); err != nil {
+		return "", "", 0, err
+	}
+
+	hourlyRate := req.HourlyRate
+	if hourlyRate == 0 {
+		hourlyRate = defaultRate
+	}
+	if hourlyRate <= 0 {
+		return "", "", 0, fmt.Errorf("hourly_rate is required")
+	}
+
+	return tableType, zone, hourlyRate, nil
+}
+
+func (s *TableService) checkTableName(name string, excludeID int) error {
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM tables WHERE name = ? AND id != ?", name, excludeID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("table name already exists")
+	}
+	return nil
+}
+
+// Take a table out of service for good. Its sessions and invoices are kept;
+// it can be brought back by setting it available.
+func (s *TableService) RetireTable(id int, retiredBy int) (*models.Table, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM tables WHERE id = ? FOR UPDATE", id).Scan(&status)
+	if err != nil {
+		return nil, fmt.Errorf("table not found")
+	}
+
+	if status == "retired" {
+		return nil, fmt.Errorf("table is already retired")
+	}
+	if status == "occupied" {
+		return nil, fmt.Errorf("table has a running session")
+	}
+
+	var bookings int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM reservations WHERE table_id = ? AND status = 'booked'", id,
+	).Scan(&bookings)
+	if err != nil {
+		return nil, err
+	}
+	if bookings > 0 {
+		return nil, fmt.Errorf("table has %d upcoming reservations", bookings)
+	}
+
+	if err := endMaintenance(tx, id, retiredBy); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE tables SET status = 'retired', cleaning_until = NULL, updated_at = NOW() WHERE id = ?", id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastTable(id)
+}
+
+// Move a table between available, cleaning and maintenance. Maintenance
+// needs a reason and is logged with who started and ended it.
+func (s *TableService) SetTableStatus(id int, req *models.TableStatusRequest, changedBy int) (*models.Table, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM tables WHERE id = ? FOR UPDATE", id).Scan(&status)
+	if err != nil {
+		return nil, fmt.Errorf("table not found")
+	}
+
+	allowed := false
+	for _, next := range tableTransitions[status] {
+		if next == req.Status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("cannot change table status from %s to %s", status, req.Status)
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if req.Status == "maintenance" && reason == "" {
+		return nil, fmt.Errorf("reason is required for maintenance")
+	}
+
+	if status == "maintenance" {
+		if err := endMaintenance(tx, id, changedBy); err != nil {
+			return nil, err
+		}
+	}
+
+	switch req.Status {
+	case "maintenance":
+		_, err = tx.Exec(
+			"INSERT INTO table_maintenance_logs (table_id, reason, started_by) VALUES (?, ?, ?)",
+			id, reason, changedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(
+			"UPDATE tables SET status = 'maintenance', cleaning_until = NULL, updated_at = NOW() WHERE id = ?", id,
+		)
+
+	case "cleaning":
+		var cleaningUntil interface{}
+		if s.cleaningTime > 0 {
+			cleaningUntil = time.Now().Add(s.cleaningTime)
+		}
+		_, err = tx.Exec(
+			"UPDATE tables SET status = 'cleaning', cleaning_until = ?, updated_at = NOW() WHERE id = ?",
+			cleaningUntil, id,
+		)
+
+	case "available":
+		// A table that is free again goes to a booking holding it, if any
+		var next string
+		next, err = releasedTableStatus(tx, uint(id))
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(
+			"UPDATE tables SET status = ?, cleaning_until = NULL, updated_at = NOW() WHERE id = ?", next, id,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastTable(id)
+}
+
+// Close the open maintenance period of a table, if there is one
+func endMaintenance(tx *sql.Tx, tableID int, endedBy int) error {
+	_, err := tx.Exec(`
+		UPDATE table_maintenance_logs SET ended_by = ?, ended_at = NOW()
+		WHERE table_id = ? AND ended_at IS NULL
+	`, endedBy, tableID)
+	return err
+}
+
+// Maintenance history of a table, most recent first
+func (s *TableService) GetMaintenanceLogs(tableID int) ([]models.TableMaintenanceLog, error) {
+	rows, err := s.db.Query(`
+		SELECT id, table_id, reason, started_by, started_at, ended_by, ended_at
+		FROM table_maintenance_logs
+		WHERE table_id = ?
+		ORDER BY started_at DESC, id DESC
+	`, tableID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []models.TableMaintenanceLog
+	for rows.Next() {
+		var entry models.TableMaintenanceLog
+		err := rows.Scan(
+			&entry.ID, &entry.TableID, &entry.Reason, &entry.StartedBy, &entry.StartedAt,
+			&entry.EndedBy, &entry.EndedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, entry)
+	}
+
+	return logs, rows.Err()
+}
+
+// Status of a table a session has just left: cleaning for a while when that
+// is configured, otherwise free (or held for a booking)
+func (s *TableService) vacateTable(tx *sql.Tx, tableID uint) error {
+	if s.cleaningTime > 0 {
+		_, err := tx.Exec(
+			"UPDATE tables SET status = 'cleaning', cleaning_until = ? WHERE id = ?",
+			time.Now().Add(s.cleaningTime), tableID,
+		)
+		return err
+	}
+
+	status, err := releasedTableStatus(tx, tableID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE tables SET status = ? WHERE id = ?", status, tableID)
+	return err
+}
+
+// Put tables whose cleaning time is up back into service
+func (s *TableService) FinishCleaning() error {
+	rows, err := s.db.Query(
+		"SELECT id FROM tables WHERE status = 'cleaning' AND cleaning_until IS NOT NULL AND cleaning_until <= NOW()",
+	)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		status, err := releasedTableStatus(s.db, id)
+		if err != nil {
+			return err
+		}
+
+		result, err := s.db.Exec(
+			"UPDATE tables SET status = ?, cleaning_until = NULL WHERE id = ? AND status = 'cleaning'",
+			status, id,
+		)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+
+		if _, err := s.broadcastTable(int(id)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reload a table after a change and push it to the board
+func (s *TableService) broadcastTable(id int) (*models.Table, error) {
+	table, err := s.GetTableByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(realtime.EventTableUpdated, table)
+	return table, nil
+}
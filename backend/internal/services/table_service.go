@@ -4,27 +4,59 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
+	"bi-a-management/internal/billing"
 	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
 )
 
+// Total paused time of a session in seconds; an open pause counts up to now.
+// Expects the session table to be aliased as s.
+const sessionPausedSecondsColumn = `
+	COALESCE((
+		SELECT SUM(TIMESTAMPDIFF(SECOND, p.paused_at, COALESCE(p.resumed_at, NOW())))
+		FROM session_pauses p
+		WHERE p.session_id = s.id
+	), 0) as paused_seconds`
+
 type TableService struct {
-	db *sql.DB
+	db           *sql.DB
+	hub          *realtime.Hub
+	policy       billing.Policy
+	cleaningTime time.Duration // 0 = tables are free as soon as a session leaves
+}
+
+func NewTableService(db *sql.DB, hub *realtime.Hub, policy billing.Policy, cleaningTime time.Duration) *TableService {
+	return &TableService{db: db, hub: hub, policy: policy, cleaningTime: cleaningTime}
 }
 
-func NewTableService(db *sql.DB) *TableService {
-	return &TableService{db: db}
+// Get all tables with current status, in board order
+func (s *TableService) GetAllTables(includeRetired bool) ([]models.Table, error) {
+	return s.FindTables(includeRetired, "", "")
 }
 
-// Get all tables with current status
-func (s *TableService) GetAllTables() ([]models.Table, error) {
+// Tables on the board, optionally of one type and/or in one zone
+func (s *TableService) FindTables(includeRetired bool, tableType string, zone string) ([]models.Table, error) {
 	query := `
-		SELECT id, name, status, hourly_rate, created_at, updated_at 
-		FROM tables 
-		ORDER BY name
-	`
-	
-	rows, err := s.db.Query(query)
+		SELECT ` + tableColumns + `
+		FROM tables
+		WHERE 1 = 1`
+	var args []interface{}
+	if !includeRetired {
+		query += " AND status != 'retired'"
+	}
+	if tableType != "" {
+		query += " AND table_type = ?"
+		args = append(args, tableType)
+	}
+	if zone != "" {
+		query += " AND zone = ?"
+		args = append(args, zone)
+	}
+	query += " ORDER BY display_order, name"
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -32,15 +64,11 @@ func (s *TableService) GetAllTables() ([]models.Table, error) {
 
 	var tables []models.Table
 	for rows.Next() {
-		var table models.Table
-		err := rows.Scan(
-			&table.ID, &table.Name, &table.Status, &table.HourlyRate,
-			&table.CreatedAt, &table.UpdatedAt,
-		)
+		table, err := scanTable(rows)
 		if err != nil {
 			return nil, err
 		}
-		tables = append(tables, table)
+		tables = append(tables, *table)
 	}
 
 	return tables, nil
@@ -48,37 +76,49 @@ func (s *TableService) GetAllTables() ([]models.Table, error) {
 
 // Start a new session
 func (s *TableService) StartSession(req *models.StartSessionRequest, createdBy int) (*models.TableSession, error) {
-	// Check if table is available
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Check if table is available; the lock keeps a second start on the same
+	// table waiting until this one is done
 	var currentStatus string
-	err := s.db.QueryRow("SELECT status FROM tables WHERE id = ?", req.TableID).Scan(&currentStatus)
+	var hourlyRate float64
+	err = tx.QueryRow(
+		"SELECT status, hourly_rate FROM tables WHERE id = ? FOR UPDATE", req.TableID,
+	).Scan(&currentStatus, &hourlyRate)
 	if err != nil {
 		return nil, fmt.Errorf("table not found")
 	}
 	
-	if currentStatus != "available" {
+	if currentStatus != "available" && currentStatus != "reserved" {
 		return nil, fmt.Errorf("table is not available")
 	}
 
-	// Get table hourly rate
-	var hourlyRate float64
-	err = s.db.QueryRow("SELECT hourly_rate FROM tables WHERE id = ?", req.TableID).Scan(&hourlyRate)
+	// Walk-ins may not take a table held for a booking
+	holdingID, err := holdingReservation(tx, req.TableID)
 	if err != nil {
 		return nil, err
 	}
+	if holdingID != 0 && holdingID != req.ReservationID {
+		return nil, fmt.Errorf("table is reserved")
+	}
 
-	// Start transaction
-	tx, err := s.db.Begin()
+	// Members are recognised by ID or phone; anyone else plays as a walk-in
+	customerID, customerName, err := resolveSessionCustomer(tx, req)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
 
 	// Create session
 	result, err := tx.Exec(`
 		INSERT INTO table_sessions 
-		(table_id, customer_name, preset_duration_minutes, remaining_minutes, hourly_rate, prepaid_amount, session_type, created_by) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, req.TableID, req.CustomerName, req.PresetDurationMinutes, req.PresetDurationMinutes, hourlyRate, req.PrepaidAmount, req.SessionType, createdBy)
+		(table_id, customer_name, customer_id, preset_duration_minutes, remaining_minutes, hourly_rate, prepaid_amount, status, session_type, created_by) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.TableID, customerName, customerID, req.PresetDurationMinutes, req.PresetDurationMinutes, hourlyRate, req.PrepaidAmount, SessionActive, req.SessionType, createdBy)
 	
 	if err != nil {
 		return nil, err
@@ -89,6 +129,19 @@ func (s *TableService) StartSession(req *models.StartSessionRequest, createdBy i
 		return nil, err
 	}
 
+	if req.ReservationID != 0 {
+		result, err := tx.Exec(`
+			UPDATE reservations SET status = 'seated', session_id = ?, updated_at = NOW()
+			WHERE id = ? AND table_id = ? AND status = 'booked'
+		`, sessionID, req.ReservationID, req.TableID)
+		if err != nil {
+			return nil, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return nil, fmt.Errorf("reservation is not booked on this table")
+		}
+	}
+
 	// Update table status
 	_, err = tx.Exec("UPDATE tables SET status = 'occupied' WHERE id = ?", req.TableID)
 	if err != nil {
@@ -100,47 +153,64 @@ func (s *TableService) StartSession(req *models.StartSessionRequest, createdBy i
 	}
 
 	// Return the created session
-	return s.GetSessionByID(int(sessionID))
+	return s.broadcastSession(int(sessionID), realtime.EventSessionStarted)
 }
 
 // Get session by ID
 func (s *TableService) GetSessionByID(id int) (*models.TableSession, error) {
+	return loadSession(s.db, id)
+}
+
+// Load a session with its table name, paused time and server-side clock
+func loadSession(q sessionQueryer, id int) (*models.TableSession, error) {
 	query := `
-		SELECT s.id, s.table_id, t.name as table_name, s.customer_name, s.start_time, 
+		SELECT s.id, s.table_id, t.name as table_name, s.customer_name, s.customer_id, s.start_time, s.end_time,
 			   s.preset_duration_minutes, s.remaining_minutes, s.actual_duration_minutes,
 			   s.hourly_rate, s.prepaid_amount, s.status, s.session_type, 
-			   s.created_by, s.created_at, s.updated_at
+			   s.created_by, s.created_at, s.updated_at,`+sessionPausedSecondsColumn+`
 		FROM table_sessions s
 		JOIN tables t ON s.table_id = t.id
 		WHERE s.id = ?
 	`
 	
 	var session models.TableSession
-	err := s.db.QueryRow(query, id).Scan(
-		&session.ID, &session.TableID, &session.TableName, &session.CustomerName,
-		&session.StartTime, &session.PresetDurationMinutes, &session.RemainingMinutes, 
+	err := q.QueryRow(query, id).Scan(
+		&session.ID, &session.TableID, &session.TableName, &session.CustomerName, &session.CustomerID,
+		&session.StartTime, &session.EndTime, &session.PresetDurationMinutes, &session.RemainingMinutes, 
 		&session.ActualDurationMinutes, &session.HourlyRate, &session.PrepaidAmount, 
 		&session.Status, &session.SessionType, &session.CreatedBy,
-		&session.CreatedAt, &session.UpdatedAt,
+		&session.CreatedAt, &session.UpdatedAt, &session.PausedSeconds,
 	)
 	
 	if err != nil {
 		return nil, err
 	}
 
+	applySessionClock(&session, time.Now())
 	return &session, nil
 }
 
+// Reload a session after a state change and push it to the table board
+func (s *TableService) broadcastSession(sessionID int, eventType string) (*models.TableSession, error) {
+	session, err := s.GetSessionByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(eventType, session)
+	return session, nil
+}
+
 // Get active sessions
 func (s *TableService) GetActiveSessions() ([]models.TableSession, error) {
 	query := `
-		SELECT s.id, s.table_id, t.name as table_name, s.customer_name, s.start_time, 
+		SELECT s.id, s.table_id, t.name as table_name, s.customer_name, s.customer_id, s.start_time, s.end_time,
 			   s.preset_duration_minutes, s.remaining_minutes, s.actual_duration_minutes,
 			   s.hourly_rate, s.prepaid_amount, s.status, s.session_type,
-			   s.created_by, s.created_at, s.updated_at
+			   s.created_by, s.created_at, s.updated_at,`+sessionPausedSecondsColumn+`
 		FROM table_sessions s
 		JOIN tables t ON s.table_id = t.id
-		WHERE s.status = 'active'
+		WHERE s.status IN ('active', 'paused', 'overtime')
 		ORDER BY s.start_time
 	`
 	
@@ -150,57 +220,424 @@ func (s *TableService) GetActiveSessions() ([]models.TableSession, error) {
 	}
 	defer rows.Close()
 
+	now := time.Now()
 	var sessions []models.TableSession
 	for rows.Next() {
 		var session models.TableSession
 		err := rows.Scan(
-			&session.ID, &session.TableID, &session.TableName, &session.CustomerName,
-			&session.StartTime, &session.PresetDurationMinutes, &session.RemainingMinutes,
+			&session.ID, &session.TableID, &session.TableName, &session.CustomerName, &session.CustomerID,
+			&session.StartTime, &session.EndTime, &session.PresetDurationMinutes, &session.RemainingMinutes,
 			&session.ActualDurationMinutes, &session.HourlyRate, &session.PrepaidAmount, 
 			&session.Status, &session.SessionType, &session.CreatedBy,
-			&session.CreatedAt, &session.UpdatedAt,
+			&session.CreatedAt, &session.UpdatedAt, &session.PausedSeconds,
 		)
 		if err != nil {
 			return nil, err
 		}
+		applySessionClock(&session, now)
 		sessions = append(sessions, session)
 	}
 
 	return sessions, nil
 }
 
-// Update remaining time
-func (s *TableService) UpdateRemainingTime(sessionID int, remainingMinutes int) error {
-	_, err := s.db.Exec(
-		"UPDATE table_sessions SET remaining_minutes = ?, updated_at = NOW() WHERE id = ?",
-		remainingMinutes, sessionID,
+// Played minutes of a session, derived from its start time minus pauses
+func sessionElapsedMinutes(session *models.TableSession, now time.Time) int {
+	paused := time.Duration(session.PausedSeconds) * time.Second
+	elapsed := int((now.Sub(session.StartTime) - paused).Minutes())
+	if elapsed < 0 {
+		return 0
+	}
+	return elapsed
+}
+
+// Derive remaining_minutes on the server instead of trusting the value the
+// browser last pushed, so the countdown keeps running with no client open
+func applySessionClock(session *models.TableSession, now time.Time) {
+	if session.Status != "active" && session.Status != "paused" && session.Status != "overtime" {
+		return
+	}
+
+	remaining := session.PresetDurationMinutes - sessionElapsedMinutes(session, now)
+	if remaining < 0 {
+		if session.SessionType == "fixed_time" {
+			session.OvertimeMinutes = -remaining
+		}
+		remaining = 0
+	}
+	session.RemainingMinutes = &remaining
+}
+
+// Admin override of the remaining time. The preset duration is shifted so the
+// derived clock shows the requested value, and the change is audited.
+func (s *TableService) AdjustRemainingTime(sessionID int, remainingMinutes int, adjustedBy int, reason string) (*models.TableSession, error) {
+	return s.adjustSessionTime(sessionID, adjustedBy, reason, func(elapsed int, preset int) int {
+		return elapsed + remainingMinutes
+	})
+}
+
+// Add minutes to a session's preset duration (negative to take them off)
+func (s *TableService) AddMinutesToSession(sessionID int, addedMinutes int, adjustedBy int) (*models.TableSession, error) {
+	reason := fmt.Sprintf("Added %d minutes", addedMinutes)
+	return s.adjustSessionTime(sessionID, adjustedBy, reason, func(elapsed int, preset int) int {
+		return preset + addedMinutes
+	})
+}
+
+// Set a session's preset duration
+func (s *TableService) UpdatePresetDuration(sessionID int, presetDurationMinutes int, adjustedBy int) (*models.TableSession, error) {
+	reason := fmt.Sprintf("Preset duration set to %d minutes", presetDurationMinutes)
+	return s.adjustSessionTime(sessionID, adjustedBy, reason, func(elapsed int, preset int) int {
+		return presetDurationMinutes
+	})
+}
+
+// Change the preset duration of a running session to what newPreset returns
+// for its played minutes and current preset. The session is locked, must be
+// active or in overtime, and the change to its remaining time is audited.
+func (s *TableService) adjustSessionTime(sessionID int, adjustedBy int, reason string, newPreset func(elapsed int, preset int) int) (*models.TableSession, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, err := lockSession(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if status != SessionActive && status != SessionOvertime {
+		return nil, &SessionStateError{SessionID: sessionID, Status: status, Action: "adjust the time of"}
+	}
+
+	session, err := loadSession(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := sessionElapsedMinutes(session, time.Now())
+	presetDuration := newPreset(elapsed, session.PresetDurationMinutes)
+	if presetDuration < 1 {
+		return nil, fmt.Errorf("preset duration must be at least 1 minute")
+	}
+
+	oldRemaining := 0
+	if session.RemainingMinutes != nil {
+		oldRemaining = *session.RemainingMinutes
+	}
+	remainingMinutes := presetDuration - elapsed
+	if remainingMinutes < 0 {
+		remainingMinutes = 0
+	}
+
+	// Giving an overtime session more time puts it back on the clock
+	if status == SessionOvertime && remainingMinutes > 0 {
+		status = SessionActive
+	}
+
+	_, err = tx.Exec(
+		"UPDATE table_sessions SET preset_duration_minutes = ?, remaining_minutes = ?, status = ?, updated_at = NOW() WHERE id = ?",
+		presetDuration, remainingMinutes, status, sessionID,
 	)
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO session_time_adjustments
+		(session_id, old_remaining_minutes, new_remaining_minutes, reason, adjusted_by)
+		VALUES (?, ?, ?, ?, ?)
+	`, sessionID, oldRemaining, remainingMinutes, reason, adjustedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastSession(sessionID, realtime.EventSessionTimeUpdated)
+}
+
+// End a session and create its invoice in one transaction. If the invoice
+// cannot be created nothing is saved: the session keeps running and its table
+// stays occupied.
+func (s *TableService) EndSession(sessionID int, createdBy int, invoices *InvoiceService) (*models.TableSession, *models.Invoice, error) {
+	// Start transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if err := s.endSession(tx, sessionID); err != nil {
+		return nil, nil, err
+	}
+
+	invoiceID, err := invoices.CreateInvoiceFromSessionTx(tx, sessionID, createdBy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	session, err := s.broadcastSession(sessionID, realtime.EventSessionEnded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	invoice, err := invoices.GetInvoiceByID(int(invoiceID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return session, invoice, nil
+}
+
+// End the sessions still running among sessionIDs and bill all of them on one
+// invoice, in one transaction
+func (s *TableService) EndSessionsWithInvoice(sessionIDs []int, createdBy int, invoices *InvoiceService) (*models.Invoice, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ended []int
+	for _, sessionID := range sessionIDs {
+		status, err := lockSession(tx, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("session %d not found", sessionID)
+		}
+		if !isLiveSession(status) {
+			continue
+		}
+
+		if err := s.endSession(tx, sessionID); err != nil {
+			return nil, err
+		}
+		ended = append(ended, sessionID)
+	}
+
+	invoiceID, err := invoices.CreateInvoiceFromSessionsTx(tx, sessionIDs, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, sessionID := range ended {
+		if _, err := s.broadcastSession(sessionID, realtime.EventSessionEnded); err != nil {
+			return nil, err
+		}
+	}
+
+	return invoices.GetInvoiceByID(int(invoiceID))
+}
+
+// Close a session inside tx: mark it completed, stop an open pause, stamp its
+// end time and played minutes, and send its table to cleaning or free it. A
+// session someone else already ended is refused.
+func (s *TableService) endSession(tx *sql.Tx, sessionID int) error {
+	if _, err := moveSession(tx, sessionID, SessionCompleted); err != nil {
+		return err
+	}
+
+	end := time.Now()
+
+	// Close a pause that is still open so paused time stops growing
+	_, err := tx.Exec("UPDATE session_pauses SET resumed_at = ? WHERE session_id = ? AND resumed_at IS NULL", end, sessionID)
+	if err != nil {
+		return err
+	}
+
+	session, err := loadSession(tx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// The invoice, and any merge done later, price the session to this end.
+	// Played minutes leave out the time spent paused.
+	_, err = tx.Exec(
+		"UPDATE table_sessions SET end_time = ?, actual_duration_minutes = ? WHERE id = ?",
+		end, sessionElapsedMinutes(session, end), sessionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Send the table to cleaning, or free it
+	return s.vacateTable(tx, session.TableID)
 }
 
-// End session
-func (s *TableService) EndSession(sessionID int) (*models.TableSession, error) {
-	// Get session details
+// Pause an active session; the expiry clock and billing stop until resumed
+func (s *TableService) PauseSession(sessionID int, pausedBy int) (*models.TableSession, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := moveSession(tx, sessionID, SessionPaused); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("INSERT INTO session_pauses (session_id, paused_by) VALUES (?, ?)", sessionID, pausedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastSession(sessionID, realtime.EventSessionPaused)
+}
+
+// Resume a paused session
+func (s *TableService) ResumeSession(sessionID int, resumedBy int) (*models.TableSession, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only a paused session resumes; active to active is not a transition
+	from, err := lockSession(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if from != SessionPaused {
+		return nil, &SessionStateError{SessionID: sessionID, Status: from, Action: "resume"}
+	}
+	if _, err := moveSession(tx, sessionID, SessionActive); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE session_pauses SET resumed_at = NOW(), resumed_by = ? WHERE session_id = ? AND resumed_at IS NULL",
+		resumedBy, sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.broadcastSession(sessionID, realtime.EventSessionResumed)
+}
+
+// Get pause intervals of a session
+func (s *TableService) GetSessionPauses(sessionID int) ([]models.SessionPause, error) {
+	return loadSessionPauses(s.db, sessionID)
+}
+
+// Get the table segments of a session, the current table last
+func (s *TableService) GetSessionSegments(sessionID int) ([]models.SessionSegment, error) {
 	session, err := s.GetSessionByID(sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Start transaction
+	return loadSessionSegments(s.db, session)
+}
+
+// Quote a running session up to now, exactly as its invoice would be billed
+func (s *TableService) QuoteSession(sessionID int) (*billing.Quote, error) {
+	session, err := s.GetSessionByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return quoteSession(s.db, s.policy, session, time.Now())
+}
+
+// Move a running session to another table. The time played so far is closed
+// as a segment billed at the old table's rate; orders stay on the session.
+func (s *TableService) TransferSession(sessionID int, toTableID uint, transferredBy int) (*models.TableSession, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	// Update session status
-	_, err = tx.Exec("UPDATE table_sessions SET status = 'completed', updated_at = NOW() WHERE id = ?", sessionID)
+	if _, err := lockLiveSession(tx, sessionID, "transfer"); err != nil {
+		return nil, err
+	}
+
+	var fromTableID uint
+	var hourlyRate float64
+	var startTime time.Time
+	err = tx.QueryRow(
+		"SELECT table_id, hourly_rate, start_time FROM table_sessions WHERE id = ?", sessionID,
+	).Scan(&fromTableID, &hourlyRate, &startTime)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update table status
-	_, err = tx.Exec("UPDATE tables SET status = 'available' WHERE id = ?", session.TableID)
+	if fromTableID == toTableID {
+		return nil, fmt.Errorf("session is already on this table")
+	}
+
+	var toStatus string
+	var toRate float64
+	err = tx.QueryRow("SELECT status, hourly_rate FROM tables WHERE id = ? FOR UPDATE", toTableID).Scan(&toStatus, &toRate)
+	if err != nil {
+		return nil, fmt.Errorf("table not found")
+	}
+
+	if toStatus != "available" {
+		return nil, fmt.Errorf("table is not available")
+	}
+
+	// The table may be held for a booking the ticker has not marked yet
+	holdingID, err := holdingReservation(tx, toTableID)
+	if err != nil {
+		return nil, err
+	}
+	if holdingID != 0 {
+		return nil, fmt.Errorf("table is reserved")
+	}
+
+	// The segment being closed starts where the previous one ended
+	var lastEnded sql.NullTime
+	err = tx.QueryRow("SELECT MAX(ended_at) FROM session_segments WHERE session_id = ?", sessionID).Scan(&lastEnded)
+	if err != nil {
+		return nil, err
+	}
+	segmentStart := startTime
+	if lastEnded.Valid {
+		segmentStart = lastEnded.Time
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO session_segments (session_id, table_id, hourly_rate, started_at, ended_at, transferred_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, sessionID, fromTableID, hourlyRate, segmentStart, now, transferredBy)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE table_sessions SET table_id = ?, hourly_rate = ?, updated_at = NOW() WHERE id = ?",
+		toTableID, toRate, sessionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.vacateTable(tx, fromTableID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE tables SET status = 'occupied' WHERE id = ?", toTableID)
 	if err != nil {
 		return nil, err
 	}
@@ -209,44 +646,94 @@ func (s *TableService) EndSession(sessionID int) (*models.TableSession, error) {
 		return nil, err
 	}
 
-	return s.GetSessionByID(sessionID)
+	return s.broadcastSession(sessionID, realtime.EventSessionTransferred)
 }
 
-// Auto-expire sessions that have run out of time
+// Flag fixed_time sessions whose server-side clock has run out as overtime,
+// and refresh the remaining_minutes snapshot of the others
 func (s *TableService) AutoExpireSessions() error {
-	log.Println("Checking for expired sessions...")
-	
-	// Find sessions where remaining time <= 0
-	query := `
-		UPDATE table_sessions 
-		SET status = 'expired', updated_at = NOW() 
-		WHERE status = 'active' AND remaining_minutes <= 0
-	`
-	
-	result, err := s.db.Exec(query)
+	sessions, err := s.GetActiveSessions()
 	if err != nil {
 		return err
 	}
 
-	affected, _ := result.RowsAffected()
-	if affected > 0 {
-		log.Printf("Expired %d sessions", affected)
-		
-		// Update table status for expired sessions
-		_, err = s.db.Exec(`
-			UPDATE tables t
-			JOIN table_sessions s ON t.id = s.table_id
-			SET t.status = 'available'
-			WHERE s.status = 'expired'
-		`)
-		if err != nil {
+	overtime := 0
+	for _, session := range sessions {
+		// Paused sessions keep their clock frozen
+		if session.Status != SessionActive || session.SessionType != "fixed_time" || session.RemainingMinutes == nil {
+			continue
+		}
+
+		if *session.RemainingMinutes > 0 {
+			_, err := s.db.Exec(
+				"UPDATE table_sessions SET remaining_minutes = ? WHERE id = ? AND status = ?",
+				*session.RemainingMinutes, session.ID, SessionActive,
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.flagOvertime(session.ID); err != nil {
 			return err
 		}
+		overtime++
+	}
+
+	if overtime > 0 {
+		log.Printf("Flagged %d sessions as overtime", overtime)
 	}
 
 	return nil
 }
 
+// Mark a session whose preset ran out as overtime. The table stays occupied
+// until staff end the session, and the extra time is billed on the invoice.
+func (s *TableService) flagOvertime(sessionID uint) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = moveSession(tx, int(sessionID), SessionOvertime)
+	if _, changed := err.(*SessionStateError); changed {
+		// Someone else paused or ended the session in the meantime
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec("UPDATE table_sessions SET remaining_minutes = 0 WHERE id = ?", sessionID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	_, err = s.broadcastSession(int(sessionID), realtime.EventSessionOvertime)
+	return err
+}
+
+// Run AutoExpireSessions and FinishCleaning on a fixed interval until the
+// process exits
+func (s *TableService) RunSessionTicker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.AutoExpireSessions(); err != nil {
+			log.Printf("Session ticker error: %v", err)
+		}
+		if err := s.FinishCleaning(); err != nil {
+			log.Printf("Table cleaning ticker error: %v", err)
+		}
+	}
+}
+
 // Update table hourly rate
 func (s *TableService) UpdateTableRate(tableID int, hourlyRate float64) error {
 	query := `UPDATE tables SET hourly_rate = ?, updated_at = NOW() WHERE id = ?`
@@ -265,23 +752,9 @@ func (s *TableService) UpdateTableRate(tableID int, hourlyRate float64) error {
 		return fmt.Errorf("table not found")
 	}
 
+	s.hub.Broadcast(realtime.EventTableRateUpdated, map[string]interface{}{
+		"table_id":    tableID,
+		"hourly_rate": hourlyRate,
+	})
 	return nil
 }
-
-// Add minutes to session
-func (s *TableService) AddMinutesToSession(sessionID int, addedMinutes int) error {
-    _, err := s.db.Exec(
-        "UPDATE table_sessions SET preset_duration_minutes = preset_duration_minutes + ?, updated_at = NOW() WHERE id = ?",
-        addedMinutes, sessionID,
-    )
-    return err
-}
-
-// Update preset duration
-func (s *TableService) UpdatePresetDuration(sessionID int, presetDurationMinutes int) error {
-    _, err := s.db.Exec(
-        "UPDATE table_sessions SET preset_duration_minutes = ?, updated_at = NOW() WHERE id = ?",
-        presetDurationMinutes, sessionID,
-    )
-    return err
-}
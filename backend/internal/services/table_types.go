@@ -0,0 +1,402 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
+)
+
+// Table types with the number of tables in service of each
+func (s *TableService) GetTableTypes() ([]models.TableType, error) {
+	rows, err := s.db.Query(`
+		SELECT tt.id, tt.code, tt.name, tt.default_hourly_rate, tt.capacity, tt.display_order,
+		       (SELECT COUNT(*) FROM tables t WHERE t.table_type = tt.code AND t.status != 'retired'),
+		       tt.created_at, tt.updated_at
+		FROM table_types tt
+		ORDER BY tt.display_order, tt.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []models.TableType
+	for rows.Next() {
+		var tableType models.TableType
+		err := rows.Scan(
+			&tableType.ID, &tableType.Code, &tableType.Name, &tableType.DefaultHourlyRate,
+			&tableType.Capacity, &tableType.DisplayOrder, &tableType.TableCount,
+			&tableType.CreatedAt, &tableType.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, tableType)
+	}
+
+	return types, rows.Err()
+}
+
+func (s *TableService) GetTableTypeByID(id int) (*models.TableType, error) {
+	types, err := s.GetTableTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range types {
+		if types[i].ID == uint(id) {
+			return &types[i], nil
+		}
+	}
+	return nil, fmt.Errorf("table type not found")
+}
+
+func (s *TableService) CreateTableType(req *models.TableTypeRequest) (*models.TableType, error) {
+	code := strings.TrimSpace(req.Code)
+	if err := checkCode(s.db, "table_types", code, 0); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO table_types (code, name, default_hourly_rate, capacity, display_order)
+		VALUES (?, ?, ?, ?, ?)
+	`, code, strings.TrimSpace(req.Name), req.DefaultHourlyRate, req.Capacity, req.DisplayOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetTableTypeByID(int(id))
+}
+
+// Update a table type. Renaming its code moves its tables and pricing rules
+// along; with ApplyToTables its tables take the new default rate, which
+// applies to sessions started afterwards.
+func (s *TableService) UpdateTableType(id int, req *models.TableTypeRequest) (*models.TableType, error) {
+	current, err := s.GetTableTypeByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if err := checkCode(s.db, "table_types", code, id); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE table_types
+		SET code = ?, name = ?, default_hourly_rate = ?, capacity = ?, display_order = ?
+		WHERE id = ?
+	`, code, strings.TrimSpace(req.Name), req.DefaultHourlyRate, req.Capacity, req.DisplayOrder, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if code != current.Code {
+		for _, table := range []string{"tables", "pricing_rules", "reservations", "waitlist_entries"} {
+			_, err = tx.Exec("UPDATE "+table+" SET table_type = ? WHERE table_type = ?", code, current.Code)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if req.ApplyToTables && req.DefaultHourlyRate > 0 {
+		_, err = tx.Exec(
+			"UPDATE tables SET hourly_rate = ?, updated_at = NOW() WHERE table_type = ?",
+			req.DefaultHourlyRate, code,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if code != current.Code || req.ApplyToTables {
+		if err := s.broadcastTablesOf("table_type", code); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetTableTypeByID(id)
+}
+
+// Delete a table type no table in service uses
+func (s *TableService) DeleteTableType(id int) error {
+	tableType, err := s.GetTableTypeByID(id)
+	if err != nil {
+		return err
+	}
+	if tableType.TableCount > 0 {
+		return fmt.Errorf("table type is used by %d tables", tableType.TableCount)
+	}
+
+	_, err = s.db.Exec("DELETE FROM table_types WHERE id = ?", id)
+	return err
+}
+
+// Zones with the number of tables in service in each
+func (s *TableService) GetZones() ([]models.TableZone, error) {
+	rows, err := s.db.Query(`
+		SELECT z.id, z.code, z.name, z.display_order,
+		       (SELECT COUNT(*) FROM tables t WHERE t.zone = z.code AND t.status != 'retired'),
+		       z.created_at, z.updated_at
+		FROM table_zones z
+		ORDER BY z.display_order, z.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var zones []models.TableZone
+	for rows.Next() {
+		var zone models.TableZone
+		err := rows.Scan(
+			&zone.ID, &zone.Code, &zone.Name, &zone.DisplayOrder, &zone.TableCount,
+			&zone.CreatedAt, &zone.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, rows.Err()
+}
+
+func (s *TableService) GetZoneByID(id int) (*models.TableZone, error) {
+	zones, err := s.GetZones()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range zones {
+		if zones[i].ID == uint(id) {
+			return &zones[i], nil
+		}
+	}
+	return nil, fmt.Errorf("zone not found")
+}
+
+func (s *TableService) CreateZone(req *models.TableZoneRequest) (*models.TableZone, error) {
+	code := strings.TrimSpace(req.Code)
+	if err := checkCode(s.db, "table_zones", code, 0); err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.Exec(
+		"INSERT INTO table_zones (code, name, display_order) VALUES (?, ?, ?)",
+		code, strings.TrimSpace(req.Name), req.DisplayOrder,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetZoneByID(int(id))
+}
+
+// Update a zone; renaming its code moves its tables and pricing rules along
+func (s *TableService) UpdateZone(id int, req *models.TableZoneRequest) (*models.TableZone, error) {
+	current, err := s.GetZoneByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if err := checkCode(s.db, "table_zones", code, id); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE table_zones SET code = ?, name = ?, display_order = ? WHERE id = ?",
+		code, strings.TrimSpace(req.Name), req.DisplayOrder, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if code != current.Code {
+		for _, table := range []string{"tables", "pricing_rules"} {
+			_, err = tx.Exec("UPDATE "+table+" SET zone = ? WHERE zone = ?", code, current.Code)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if code != current.Code {
+		if err := s.broadcastTablesOf("zone", code); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetZoneByID(id)
+}
+
+// Delete a zone no table in service stands in
+func (s *TableService) DeleteZone(id int) error {
+	zone, err := s.GetZoneByID(id)
+	if err != nil {
+		return err
+	}
+	if zone.TableCount > 0 {
+		return fmt.Errorf("zone has %d tables", zone.TableCount)
+	}
+
+	_, err = s.db.Exec("DELETE FROM table_zones WHERE id = ?", id)
+	return err
+}
+
+// Group tables by type or zone, in the order types and zones are set up;
+// tables without one come last
+func (s *TableService) GroupTables(tables []models.Table, groupBy string) ([]models.TableGroup, error) {
+	var groups []models.TableGroup
+	switch groupBy {
+	case "type":
+		types, err := s.GetTableTypes()
+		if err != nil {
+			return nil, err
+		}
+		for _, tableType := range types {
+			groups = append(groups, models.TableGroup{Code: tableType.Code, Name: tableType.Name})
+		}
+	case "zone":
+		zones, err := s.GetZones()
+		if err != nil {
+			return nil, err
+		}
+		for _, zone := range zones {
+			groups = append(groups, models.TableGroup{Code: zone.Code, Name: zone.Name})
+		}
+	default:
+		return nil, fmt.Errorf("group_by must be type or zone")
+	}
+
+	index := make(map[string]int)
+	for i, group := range groups {
+		index[group.Code] = i
+	}
+
+	for _, table := range tables {
+		code := table.TableType
+		if groupBy == "zone" {
+			code = table.Zone
+		}
+
+		i, ok := index[code]
+		if !ok {
+			// Tables whose code has no type or zone set up yet get a group of their own
+			groups = append(groups, models.TableGroup{Code: code, Name: code})
+			i = len(groups) - 1
+			index[code] = i
+		}
+		groups[i].Tables = append(groups[i].Tables, table)
+	}
+
+	// Leave out types and zones with no tables
+	var filled []models.TableGroup
+	for _, group := range groups {
+		if len(group.Tables) > 0 {
+			filled = append(filled, group)
+		}
+	}
+
+	return filled, nil
+}
+
+// Default rate for a new table of the given type; 0 when the type has none
+func defaultHourlyRate(q sessionQueryer, tableType string) (float64, error) {
+	if tableType == "" {
+		return 0, nil
+	}
+
+	var rate float64
+	err := q.QueryRow("SELECT default_hourly_rate FROM table_types WHERE code = ?", tableType).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("unknown table type %s", tableType)
+	}
+	return rate, err
+}
+
+// Check a zone code refers to a zone that is set up
+func checkZone(q sessionQueryer, zone string) error {
+	if zone == "" {
+		return nil
+	}
+
+	var count int
+	if err := q.QueryRow("SELECT COUNT(*) FROM table_zones WHERE code = ?", zone).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("unknown zone %s", zone)
+	}
+	return nil
+}
+
+func checkCode(q sessionQueryer, table string, code string, excludeID int) error {
+	if code == "" {
+		return fmt.Errorf("code is required")
+	}
+
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE code = ? AND id != ?", code, excludeID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("code already exists")
+	}
+	return nil
+}
+
+// Push every table of a type or zone to the board
+func (s *TableService) broadcastTablesOf(column string, code string) error {
+	rows, err := s.db.Query("SELECT "+tableColumns+" FROM tables WHERE "+column+" = ?", code)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		table, err := scanTable(rows)
+		if err != nil {
+			return err
+		}
+		s.hub.Broadcast(realtime.EventTableUpdated, table)
+	}
+
+	return rows.Err()
+}
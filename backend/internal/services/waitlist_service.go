@@ -0,0 +1,357 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"bi-a-management/internal/models"
+	"bi-a-management/internal/realtime"
+)
+
+const waitlistColumns = `
+	w.id, w.customer_name, COALESCE(w.phone, ''), w.party_size, COALESCE(w.table_type, ''),
+	w.status, w.table_id, COALESCE(t.name, ''), COALESCE(w.note, ''), w.called_at,
+	w.created_by, w.created_at, w.updated_at`
+
+type WaitlistService struct {
+	db           *sql.DB
+	hub          *realtime.Hub
+	tableService *TableService
+}
+
+func NewWaitlistService(db *sql.DB, hub *realtime.Hub, tableService *TableService) *WaitlistService {
+	return &WaitlistService{db: db, hub: hub, tableService: tableService}
+}
+
+// Parties still waiting or called to a table, in arrival order, with their
+// place in line and estimated wait
+func (s *WaitlistService) GetWaitlist() ([]models.WaitlistEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + waitlistColumns + `
+		FROM waitlist_entries w
+		LEFT JOIN tables t ON w.table_id = t.id
+		WHERE w.status IN ('waiting', 'called')
+		ORDER BY w.created_at, w.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.WaitlistEntry
+	for rows.Next() {
+		entry, err := scanWaitlistEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.estimateWaits(entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *WaitlistService) GetEntryByID(id int) (*models.WaitlistEntry, error) {
+	row := s.db.QueryRow(`
+		SELECT `+waitlistColumns+`
+		FROM waitlist_entries w
+		LEFT JOIN tables t ON w.table_id = t.id
+		WHERE w.id = ?
+	`, id)
+
+	entry, err := scanWaitlistEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("waitlist entry not found")
+	}
+	return entry, err
+}
+
+func scanWaitlistEntry(row interface{ Scan(...interface{}) error }) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := row.Scan(
+		&entry.ID, &entry.CustomerName, &entry.Phone, &entry.PartySize, &entry.TableType,
+		&entry.Status, &entry.TableID, &entry.TableName, &entry.Note, &entry.CalledAt,
+		&entry.CreatedBy, &entry.CreatedAt, &entry.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Add a party to the end of the line
+func (s *WaitlistService) AddParty(req *models.WaitlistRequest, createdBy int) (*models.WaitlistEntry, error) {
+	partySize := req.PartySize
+	if partySize == 0 {
+		partySize = 1
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO waitlist_entries (customer_name, phone, party_size, table_type, note, created_by)
+		VALUES (?, NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), ?)
+	`, req.CustomerName, req.Phone, partySize, strings.TrimSpace(req.TableType), req.Note, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.entryWithEstimate(int(id))
+}
+
+// Call the first waiting party, or the first one that fits the given table,
+// and push the call to the lobby display
+func (s *WaitlistService) CallNext(tableID uint) (*models.WaitlistEntry, error) {
+	query := "SELECT id FROM waitlist_entries WHERE status = 'waiting'"
+	var args []interface{}
+	if tableID != 0 {
+		var status, tableType string
+		err := s.db.QueryRow(
+			"SELECT status, COALESCE(table_type, '') FROM tables WHERE id = ?", tableID,
+		).Scan(&status, &tableType)
+		if err != nil {
+			return nil, fmt.Errorf("table not found")
+		}
+		if status != "available" {
+			return nil, fmt.Errorf("table is not available")
+		}
+		query += " AND (table_type IS NULL OR table_type = ?)"
+		args = append(args, tableType)
+	}
+	query += " ORDER BY created_at, id LIMIT 1"
+
+	var id int
+	err := s.db.QueryRow(query, args...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no party is waiting")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var calledTable interface{}
+	if tableID != 0 {
+		calledTable = tableID
+	}
+	_, err = s.db.Exec(`
+		UPDATE waitlist_entries SET status = 'called', table_id = ?, called_at = NOW(), updated_at = NOW()
+		WHERE id = ? AND status = 'waiting'
+	`, calledTable, id)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.GetEntryByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(realtime.EventWaitlistCalled, entry)
+	if err := s.broadcastWaitlist(); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// Take a party off the list, either because it was seated or because it left
+func (s *WaitlistService) RemoveEntry(id int, seated bool) (*models.WaitlistEntry, error) {
+	status := "removed"
+	if seated {
+		status = "seated"
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE waitlist_entries SET status = ?, updated_at = NOW()
+		WHERE id = ? AND status IN ('waiting', 'called')
+	`, status, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := s.GetEntryByID(id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("waitlist entry is no longer waiting")
+	}
+
+	if err := s.broadcastWaitlist(); err != nil {
+		return nil, err
+	}
+
+	return s.GetEntryByID(id)
+}
+
+// The first waiting party that fits a table that has just been freed. The
+// suggestion is pushed to the board; staff confirm it with CallNext.
+func (s *WaitlistService) SuggestForTable(tableID uint) (*models.WaitlistEntry, error) {
+	var status, tableName, tableType string
+	err := s.db.QueryRow(
+		"SELECT status, name, COALESCE(table_type, '') FROM tables WHERE id = ?", tableID,
+	).Scan(&status, &tableName, &tableType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Held for a booking, or not free for another reason; a table being
+	// cleaned is about to be free
+	if status != "available" && status != "cleaning" {
+		return nil, nil
+	}
+
+	var id int
+	err = s.db.QueryRow(`
+		SELECT id FROM waitlist_entries
+		WHERE status = 'waiting' AND (table_type IS NULL OR table_type = ?)
+		ORDER BY created_at, id
+		LIMIT 1
+	`, tableType).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := s.entryWithEstimate(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(realtime.EventWaitlistSuggested, map[string]interface{}{
+		"table_id":   tableID,
+		"table_name": tableName,
+		"entry":      entry,
+	})
+	return entry, nil
+}
+
+// Load an entry from the current list so it carries its position and
+// estimate, and push the updated list
+func (s *WaitlistService) entryWithEstimate(id int) (*models.WaitlistEntry, error) {
+	entries, err := s.GetWaitlist()
+	if err != nil {
+		return nil, err
+	}
+
+	s.hub.Broadcast(realtime.EventWaitlistUpdated, entries)
+
+	for i := range entries {
+		if int(entries[i].ID) == id {
+			return &entries[i], nil
+		}
+	}
+	return s.GetEntryByID(id)
+}
+
+// Push the current list to the lobby display
+func (s *WaitlistService) broadcastWaitlist() error {
+	entries, err := s.GetWaitlist()
+	if err != nil {
+		return err
+	}
+
+	s.hub.Broadcast(realtime.EventWaitlistUpdated, entries)
+	return nil
+}
+
+// When a table is expected to be free, in minutes from now
+type tableOpening struct {
+	TableType string
+	Minutes   int
+}
+
+// Estimate each waiting party's wait by handing out the expected table
+// openings in order. Free tables open now, tables being cleaned when the
+// cleaning is done and fixed_time sessions when their remaining time runs
+// out; open_play sessions have no predictable end.
+func (s *WaitlistService) estimateWaits(entries []models.WaitlistEntry) error {
+	tables, err := s.tableService.GetAllTables(false)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := s.tableService.GetActiveSessions()
+	if err != nil {
+		return err
+	}
+
+	sessionByTable := make(map[uint]models.TableSession)
+	for _, session := range sessions {
+		sessionByTable[session.TableID] = session
+	}
+
+	// Tables already promised to a called party are not free for the others
+	promised := make(map[uint]bool)
+	for _, entry := range entries {
+		if entry.Status == "called" && entry.TableID != nil {
+			promised[*entry.TableID] = true
+		}
+	}
+
+	var openings []tableOpening
+	for _, table := range tables {
+		if promised[table.ID] {
+			continue
+		}
+
+		switch table.Status {
+		case "available":
+			openings = append(openings, tableOpening{TableType: table.TableType})
+		case "cleaning":
+			minutes := 0
+			if table.CleaningUntil != nil {
+				minutes = int(math.Ceil(time.Until(*table.CleaningUntil).Minutes()))
+			}
+			if minutes < 0 {
+				minutes = 0
+			}
+			openings = append(openings, tableOpening{TableType: table.TableType, Minutes: minutes})
+		case "occupied":
+			session, ok := sessionByTable[table.ID]
+			if !ok || session.SessionType != "fixed_time" || session.RemainingMinutes == nil {
+				continue
+			}
+			openings = append(openings, tableOpening{TableType: table.TableType, Minutes: *session.RemainingMinutes})
+		}
+	}
+	sort.SliceStable(openings, func(i, j int) bool { return openings[i].Minutes < openings[j].Minutes })
+
+	position := 0
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Status == "called" {
+			zero := 0
+			entry.EstimatedWaitMinutes = &zero
+			continue
+		}
+
+		position++
+		entry.Position = position
+		for j, opening := range openings {
+			if entry.TableType != "" && entry.TableType != opening.TableType {
+				continue
+			}
+			minutes := opening.Minutes
+			entry.EstimatedWaitMinutes = &minutes
+			openings = append(openings[:j], openings[j+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package vietqr
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	if got := CRC16("123456789"); got != 0x29B1 {
+		t.Fatalf("CRC16 = %04X, want 29B1", got)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	transfer := Transfer{BankBIN: "970436", AccountNo: "0123456789", Amount: 150000, Reference: "HD42"}
+	payload, err := transfer.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "000201" + "010212" +
+		"3854" + "0010A000000727" + "0124" + "0006970436" + "01100123456789" + "0208QRIBFTTA" +
+		"5303704" + "5406150000" + "5802VN" + "62080804HD42" + "6304"
+	if payload[:len(payload)-4] != want {
+		t.Fatalf("payload = %s\nwant      %s....", payload, want)
+	}
+	if got, wantCRC := payload[len(payload)-4:], fmt.Sprintf("%04X", CRC16(want)); got != wantCRC {
+		t.Errorf("checksum = %s, want %s", got, wantCRC)
+	}
+
+	static, err := Transfer{BankBIN: "970436", AccountNo: "0123456789"}.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if static[:12] != "000201010211" {
+		t.Errorf("payload without amount should be static: %s", static)
+	}
+
+	invalid := []Transfer{
+		{BankBIN: "97043", AccountNo: "1"},
+		{BankBIN: "970436", AccountNo: ""},
+		{BankBIN: "970436", AccountNo: "1", Amount: -1},
+		{BankBIN: "970436", AccountNo: "1", Reference: "HD 42"},
+	}
+	for _, transfer := range invalid {
+		if _, err := transfer.Payload(); err == nil {
+			t.Errorf("%+v should be rejected", transfer)
+		}
+	}
+}
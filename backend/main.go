@@ -3,10 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
+	"bi-a-management/internal/billing"
 	"bi-a-management/internal/config"
 	"bi-a-management/internal/database"
+	"bi-a-management/internal/realtime"
 	"bi-a-management/internal/routes"
+	"bi-a-management/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -33,11 +37,26 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Start the live table board hub
+	hub := realtime.NewHub()
+	go hub.Run()
+
+	// Run session clocks on the server so fixed_time sessions are flagged as
+	// overtime even when no front desk tab is open
+	tickInterval := time.Duration(cfg.SessionTickSeconds) * time.Second
+	tableService := services.NewTableService(db, hub, billing.NewPolicy(cfg), time.Duration(cfg.TableCleaningMinutes)*time.Minute)
+	go tableService.RunSessionTicker(tickInterval)
+
+	// Hold booked tables and release no-shows on the same interval
+	reservationService := services.NewReservationService(db, hub, tableService,
+		time.Duration(cfg.ReservationHoldMinutes)*time.Minute, time.Duration(cfg.ReservationNoShowMinutes)*time.Minute)
+	go reservationService.RunReservationTicker(tickInterval)
+
 	// Set Gin mode
 	gin.SetMode(cfg.GinMode)
 
 	// Initialize router
-	router := routes.SetupRoutes(db, cfg)
+	router := routes.SetupRoutes(db, cfg, hub, tableService, reservationService)
 
 	// Start server
 	port := os.Getenv("PORT")